@@ -24,6 +24,7 @@ import (
 	"github.com/openshift/pagerduty-operator/pkg/apis"
 	"github.com/openshift/pagerduty-operator/pkg/controller"
 	operatormetrics "github.com/openshift/pagerduty-operator/pkg/metrics"
+	"github.com/openshift/pagerduty-operator/pkg/tracing"
 
 	hivev1 "github.com/openshift/hive/pkg/apis/hive/v1alpha1"
 	"github.com/operator-framework/operator-sdk/pkg/leader"
@@ -73,6 +74,13 @@ func main() {
 	// uniform and structured logs.
 	logf.SetLogger(zap.Logger())
 
+	// OPERATOR_TRACING=log installs the logging tracer, emitting the
+	// PagerDuty and Vault spans as structured log entries. Without it the
+	// spans stay no-ops.
+	if os.Getenv("OPERATOR_TRACING") == "log" {
+		tracing.SetGlobalTracer(tracing.NewLogTracer(logf.Log.WithName("tracing")))
+	}
+
 	printVersion()
 
 	// Get a config to talk to the apiserver
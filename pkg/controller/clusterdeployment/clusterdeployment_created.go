@@ -45,20 +45,24 @@ func (r *ReconcileClusterDeployment) handleCreate(request reconcile.Request, ins
 		ClusterID:  instance.Spec.ClusterName,
 		BaseDomain: instance.Spec.BaseDomain,
 	}
-	pdData.ParsePDConfig(r.client)
+	if !pdData.ConfigureFromShared() {
+		// No snapshot has been loaded yet, e.g. right after startup, so
+		// fall back to parsing the secret directly.
+		pdData.ParsePDConfig(r.client)
+	}
 	// To prevent scoping issues in the err check below.
 	var pdIntegrationKey string
 
-	err := pdData.ParseClusterConfig(r.client, request.Namespace, request.Name)
+	err := pdData.ParseClusterConfig(r.client, request.Namespace, request.Name, "")
 	if err != nil {
 		var createErr error
-		pdIntegrationKey, createErr = pdData.CreateService()
+		pdIntegrationKey, createErr = pdData.CreateService(context.TODO())
 		if createErr != nil {
 			return reconcile.Result{}, createErr
 		}
 	}
 
-	pdIntegrationKey, err = pdData.GetIntegrationKey()
+	pdIntegrationKey, err = pdData.GetIntegrationKey(context.TODO())
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -81,7 +85,7 @@ func (r *ReconcileClusterDeployment) handleCreate(request reconcile.Request, ins
 	}
 
 	r.reqLogger.Info("Creating configmap")
-	newCM := kube.GenerateConfigMap(request.Namespace, request.Name, pdData.ServiceID, pdData.IntegrationID)
+	newCM := kube.GenerateConfigMap(request.Namespace, request.Name, pdData.ServiceID, pdData.IntegrationID, pdData.IntegrationIDs)
 	if err = controllerutil.SetControllerReference(instance, newCM, r.scheme); err != nil {
 		r.reqLogger.Error(err, "Error setting controller reference on configmap")
 		return reconcile.Result{}, err
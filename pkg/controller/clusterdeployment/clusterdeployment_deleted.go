@@ -29,17 +29,20 @@ func (r *ReconcileClusterDeployment) handleDelete(request reconcile.Request, ins
 		ClusterID:  instance.Spec.ClusterName,
 		BaseDomain: instance.Spec.BaseDomain,
 	}
-	err := pdData.ParsePDConfig(r.client)
-	if err != nil {
-		return reconcile.Result{}, err
+	if !pdData.ConfigureFromShared() {
+		// Nothing published yet; read the secret ourselves.
+		err := pdData.ParsePDConfig(r.client)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
 	}
 
-	err = pdData.ParseClusterConfig(r.client, request.Namespace, request.Name)
+	err := pdData.ParseClusterConfig(r.client, request.Namespace, request.Name, "")
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
-	err = pdData.DeleteService()
+	err = pdData.DeleteService(context.TODO(), false)
 	if err != nil {
 		r.reqLogger.Error(err, "Failed cleaning up pagerduty.")
 	}
@@ -0,0 +1,98 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pdconfig
+
+import (
+	"github.com/openshift/pagerduty-operator/config"
+	pd "github.com/openshift/pagerduty-operator/pkg/pagerduty"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_pdconfig")
+
+// pdSecretName is the secret holding the PD config, matching the default
+// used by ParsePDConfig
+const pdSecretName = "pagerduty-api-key"
+
+// Add creates a new PD config Controller and adds it to the Manager. The
+// Manager will set fields on the Controller and Start it when the Manager
+// is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcilePDConfig{client: mgr.GetClient()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New("pdconfig-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to secrets; everything but the PD config secret is
+	// filtered out in Reconcile.
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ reconcile.Reconciler = &ReconcilePDConfig{}
+
+// ReconcilePDConfig reloads the shared PD config snapshot when the PD config
+// secret changes, so edits to the secret take effect without an operator
+// restart
+type ReconcilePDConfig struct {
+	client client.Client
+}
+
+// Reconcile re-parses the PD config secret into the shared snapshot whenever
+// it changes. Other secrets are ignored.
+func (r *ReconcilePDConfig) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	if request.Namespace != config.OperatorNamespace || request.Name != pdSecretName {
+		return reconcile.Result{}, nil
+	}
+
+	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	reqLogger.Info("Reloading PagerDuty config")
+
+	err := pd.ReloadSharedConfig(r.client)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// The secret was deleted; keep serving the last good snapshot.
+			reqLogger.Info("PagerDuty config secret not found, keeping previous config")
+			return reconcile.Result{}, nil
+		}
+		reqLogger.Error(err, "Failed to reload PagerDuty config, keeping previous config")
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
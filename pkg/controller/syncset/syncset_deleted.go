@@ -41,17 +41,20 @@ func (r *ReconcileSyncSet) recreateSyncSet(request reconcile.Request) (reconcile
 		ClusterID:  clusterdeployment.Spec.ClusterName,
 		BaseDomain: clusterdeployment.Spec.BaseDomain,
 	}
-	pdData.ParsePDConfig(r.client)
-	pdData.ParseClusterConfig(r.client, request.Namespace, cdName)
+	if !pdData.ConfigureFromShared() {
+		// The shared snapshot may not exist yet on a fresh start.
+		pdData.ParsePDConfig(r.client)
+	}
+	pdData.ParseClusterConfig(r.client, request.Namespace, cdName, "")
 
 	// To prevent scoping issues in the err check below.
 	var pdIntegrationKey string
 	recreateCM := false
 
-	pdIntegrationKey, err = pdData.GetIntegrationKey()
+	pdIntegrationKey, err = pdData.GetIntegrationKey(context.TODO())
 	if err != nil {
 		var createErr error
-		pdIntegrationKey, createErr = pdData.CreateService()
+		pdIntegrationKey, createErr = pdData.CreateService(context.TODO())
 		if createErr != nil {
 			return reconcile.Result{}, createErr
 		}
@@ -72,7 +75,7 @@ func (r *ReconcileSyncSet) recreateSyncSet(request reconcile.Request) (reconcile
 			}
 		}
 		r.client.Delete(context.TODO(), pdAPIConfigMap)
-		newCM := kube.GenerateConfigMap(request.Namespace, cdName, pdData.ServiceID, pdData.IntegrationID)
+		newCM := kube.GenerateConfigMap(request.Namespace, cdName, pdData.ServiceID, pdData.IntegrationID, pdData.IntegrationIDs)
 		if err := r.client.Create(context.TODO(), newCM); err != nil {
 			if errors.IsAlreadyExists(err) {
 				if updateErr := r.client.Update(context.TODO(), newCM); updateErr != nil {
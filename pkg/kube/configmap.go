@@ -17,20 +17,27 @@ package kube
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pd "github.com/openshift/pagerduty-operator/pkg/pagerduty"
 )
 
 // GenerateConfigMap returns a configmap that can be created with the oc client
-func GenerateConfigMap(namespace string, name string, pdServiceID string, pdIntegrationID string) *corev1.ConfigMap {
+func GenerateConfigMap(namespace string, name string, pdServiceID string, pdIntegrationID string, pdIntegrationIDs map[string]string) *corev1.ConfigMap {
 	cmName := name + "-pd-config"
 
+	cmData := map[string]string{
+		"SERVICE_ID":     pdServiceID,
+		"INTEGRATION_ID": pdIntegrationID,
+	}
+	for integrationName, integrationID := range pdIntegrationIDs {
+		cmData["INTEGRATION_ID_"+pd.IntegrationConfigMapKey(integrationName)] = integrationID
+	}
+
 	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cmName,
 			Namespace: namespace,
 		},
-		Data: map[string]string{
-			"SERVICE_ID":     pdServiceID,
-			"INTEGRATION_ID": pdIntegrationID,
-		},
+		Data: cmData,
 	}
 }
@@ -33,6 +33,10 @@ var (
 
 	metricsList = []prometheus.Collector{
 		metricPlaceholder,
+		metricVaultRequestsTotal,
+		metricVaultCacheTotal,
+		metricVaultRequestDuration,
+		metricServiceCacheTotal,
 	}
 )
 
@@ -0,0 +1,32 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricServiceCacheTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pagerduty_service_cache_total",
+		Help: "GetService cache lookups by result (hit or miss)",
+	}, []string{"result"})
+)
+
+// IncServiceCache counts one GetService cache lookup; result is "hit" or
+// "miss"
+func IncServiceCache(result string) {
+	metricServiceCacheTotal.With(prometheus.Labels{"result": result}).Inc()
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricVaultRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_requests_total",
+		Help: "Number of live Vault reads, labeled by result",
+	}, []string{"result"})
+
+	metricVaultCacheTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_cache_total",
+		Help: "Number of Vault secret lookups served from or missing the local cache",
+	}, []string{"result"})
+
+	metricVaultRequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "vault_request_duration_seconds",
+		Help: "Latency of live Vault reads",
+	})
+)
+
+// ObserveVaultRequest records the outcome and latency of a live Vault read
+func ObserveVaultRequest(result string, duration time.Duration) {
+	metricVaultRequestsTotal.With(prometheus.Labels{"result": result}).Inc()
+	metricVaultRequestDuration.Observe(duration.Seconds())
+}
+
+// IncVaultCache counts a Vault cache lookup as a hit or miss
+func IncVaultCache(result string) {
+	metricVaultCacheTotal.With(prometheus.Labels{"result": result}).Inc()
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"sync"
+)
+
+// ClusterServiceResult holds the outcome for one cluster in a batch create
+type ClusterServiceResult struct {
+	Result *CreateServiceResult
+	Err    error
+}
+
+// CreateServices ensures the service for every given cluster, fanning the
+// work out over a pool of at most concurrency workers so onboarding a fleet
+// does not run one cluster at a time. Rate limiting is still honored per
+// call by the retry logic. The outcome for each cluster is returned keyed
+// by its cluster ID.
+func CreateServices(ctx context.Context, datas []*Data, concurrency int) map[string]ClusterServiceResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	jobs := make(chan *Data)
+	results := make(map[string]ClusterServiceResult, len(datas))
+	var resultsMux sync.Mutex
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for data := range jobs {
+				result, err := data.CreateServiceWithResult(ctx)
+
+				resultsMux.Lock()
+				results[data.ClusterID] = ClusterServiceResult{Result: result, Err: err}
+				resultsMux.Unlock()
+			}
+		}()
+	}
+
+	for _, data := range datas {
+		jobs <- data
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned when the circuit breaker is fast-failing calls
+// because PagerDuty kept failing
+var ErrBreakerOpen = errors.New("pagerduty circuit breaker is open")
+
+// Circuit breaker states as reported by BreakerState.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// breaker is a simple circuit breaker: it opens after threshold consecutive
+// failures, fast-fails calls for a cool-down period, then lets probe calls
+// through until one succeeds or re-opens it
+type breaker struct {
+	mux       sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+}
+
+// allow reports whether a call may proceed, returning ErrBreakerOpen while
+// the breaker is open and still cooling down
+func (b *breaker) allow() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if time.Since(b.openedAt) < b.cooldown {
+		return ErrBreakerOpen
+	}
+	// Half-open: the call goes through as a probe; its result decides
+	// whether the breaker closes or re-opens.
+	return nil
+}
+
+// record feeds a call result into the breaker. Context cancellation says
+// nothing about PagerDuty's health and is ignored, as are deterministic
+// client errors like a 404: those describe the request, not the api, so
+// they neither open nor close the breaker. Only transport failures and
+// retryable statuses count toward the threshold.
+func (b *breaker) record(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	if !isRetryable(err) {
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// state returns the current breaker state
+func (b *breaker) state() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	switch {
+	case b.failures < b.threshold:
+		return BreakerClosed
+	case time.Since(b.openedAt) < b.cooldown:
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+// getBreaker returns the breaker guarding this Data's api calls
+func (data *Data) getBreaker() *breaker {
+	data.breakerMux.Lock()
+	defer data.breakerMux.Unlock()
+
+	if data.breaker == nil {
+		data.breaker = &breaker{
+			threshold: defaultBreakerThreshold,
+			cooldown:  defaultBreakerCooldown,
+		}
+	}
+	return data.breaker
+}
+
+// BreakerState reports the circuit breaker state so it can be surfaced in
+// metrics
+func (data *Data) BreakerState() string {
+	return data.getBreaker().state()
+}
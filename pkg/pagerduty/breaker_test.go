@@ -0,0 +1,56 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensOnServerErrors(t *testing.T) {
+	b := &breaker{threshold: 5, cooldown: 30 * time.Second}
+
+	serverErr := errors.New("Failed call API endpoint. HTTP response code: 503. Error: upstream down")
+	for i := 0; i < 5; i++ {
+		b.record(serverErr)
+	}
+	if err := b.allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("expected the breaker to open after 5 server errors, allow returned %v", err)
+	}
+}
+
+func TestBreakerIgnoresClientErrors(t *testing.T) {
+	b := &breaker{threshold: 5, cooldown: 30 * time.Second}
+
+	notFound := errors.New("Failed call API endpoint. HTTP response code: 404. Error: not found")
+	for i := 0; i < 10; i++ {
+		b.record(notFound)
+	}
+	if err := b.allow(); err != nil {
+		t.Errorf("expected routine 404s to leave the breaker closed, allow returned %v", err)
+	}
+}
+
+func TestBreakerIgnoresWrappedContextErrors(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: 30 * time.Second}
+
+	b.record(fmt.Errorf("listing services: %w", context.Canceled))
+	if err := b.allow(); err != nil {
+		t.Errorf("expected a wrapped cancellation to be ignored, allow returned %v", err)
+	}
+}
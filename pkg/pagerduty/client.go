@@ -0,0 +1,47 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+
+	pdApi "github.com/PagerDuty/go-pagerduty"
+	"github.com/openshift/pagerduty-operator/pkg/pdcompat"
+)
+
+// pdClient is the subset of the PagerDuty api the operator uses. Data holds
+// a value of this interface, defaulting to the real client, so tests can
+// substitute a fake. The context-aware variants are used throughout so a
+// reconcile deadline actually aborts in-flight requests.
+type pdClient interface {
+	GetServiceWithContext(ctx context.Context, id string, o *pdApi.GetServiceOptions) (*pdApi.Service, error)
+	ListServicesWithContext(ctx context.Context, o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error)
+	CreateServiceWithContext(ctx context.Context, s pdApi.Service) (*pdApi.Service, error)
+	UpdateServiceWithContext(ctx context.Context, s pdApi.Service) (*pdApi.Service, error)
+	DeleteServiceWithContext(ctx context.Context, id string) error
+	GetIntegrationWithContext(ctx context.Context, serviceID string, integrationID string, o pdApi.GetIntegrationOptions) (*pdApi.Integration, error)
+	CreateIntegrationWithContext(ctx context.Context, id string, i pdApi.Integration) (*pdApi.Integration, error)
+	DeleteIntegrationWithContext(ctx context.Context, serviceID string, integrationID string) error
+	GetEscalationPolicyWithContext(ctx context.Context, id string, o *pdApi.GetEscalationPolicyOptions) (*pdApi.EscalationPolicy, error)
+	ListEscalationPoliciesWithContext(ctx context.Context, o pdApi.ListEscalationPoliciesOptions) (*pdApi.ListEscalationPoliciesResponse, error)
+	CreateEscalationPolicyWithContext(ctx context.Context, e pdApi.EscalationPolicy) (*pdApi.EscalationPolicy, error)
+	GetTeamWithContext(ctx context.Context, id string) (*pdApi.Team, error)
+	GetVendorWithContext(ctx context.Context, id string) (*pdApi.Vendor, error)
+	CreateMaintenanceWindowsWithContext(ctx context.Context, m pdApi.MaintenanceWindow) (*pdApi.MaintenanceWindow, error)
+	ListIncidentsWithContext(ctx context.Context, o pdApi.ListIncidentsOptions) (*pdApi.ListIncidentsResponse, error)
+	ManageIncidentsWithContext(ctx context.Context, from string, incidents []pdApi.Incident) error
+}
+
+var _ pdClient = &pdcompat.Client{}
@@ -0,0 +1,191 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pdApi "github.com/PagerDuty/go-pagerduty"
+)
+
+// fakeClient implements pdClient with one hook per method, so each test only
+// fills in the calls it expects. A call without a hook fails the test.
+type fakeClient struct {
+	t *testing.T
+
+	getService     func(id string, o *pdApi.GetServiceOptions) (*pdApi.Service, error)
+	listServices   func(o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error)
+	createService  func(s pdApi.Service) (*pdApi.Service, error)
+	updateService  func(s pdApi.Service) (*pdApi.Service, error)
+	deleteService  func(id string) error
+	getIntegration func(serviceID string, integrationID string, o pdApi.GetIntegrationOptions) (*pdApi.Integration, error)
+
+	createIntegration func(id string, i pdApi.Integration) (*pdApi.Integration, error)
+	deleteIntegration func(serviceID string, integrationID string) error
+
+	getEscalationPolicy    func(id string, o *pdApi.GetEscalationPolicyOptions) (*pdApi.EscalationPolicy, error)
+	listEscalationPolicies func(o pdApi.ListEscalationPoliciesOptions) (*pdApi.ListEscalationPoliciesResponse, error)
+	createEscalationPolicy func(e pdApi.EscalationPolicy) (*pdApi.EscalationPolicy, error)
+
+	getTeam                  func(id string) (*pdApi.Team, error)
+	getVendor                func(id string) (*pdApi.Vendor, error)
+	createMaintenanceWindows func(m pdApi.MaintenanceWindow) (*pdApi.MaintenanceWindow, error)
+	listIncidents            func(o pdApi.ListIncidentsOptions) (*pdApi.ListIncidentsResponse, error)
+	manageIncidents          func(from string, incidents []pdApi.Incident) error
+}
+
+var _ pdClient = &fakeClient{}
+
+func (f *fakeClient) GetServiceWithContext(ctx context.Context, id string, o *pdApi.GetServiceOptions) (*pdApi.Service, error) {
+	if f.getService == nil {
+		f.t.Fatal("unexpected GetService call")
+	}
+	return f.getService(id, o)
+}
+
+func (f *fakeClient) ListServicesWithContext(ctx context.Context, o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error) {
+	if f.listServices == nil {
+		f.t.Fatal("unexpected ListServices call")
+	}
+	return f.listServices(o)
+}
+
+func (f *fakeClient) CreateServiceWithContext(ctx context.Context, s pdApi.Service) (*pdApi.Service, error) {
+	if f.createService == nil {
+		f.t.Fatal("unexpected CreateService call")
+	}
+	return f.createService(s)
+}
+
+func (f *fakeClient) UpdateServiceWithContext(ctx context.Context, s pdApi.Service) (*pdApi.Service, error) {
+	if f.updateService == nil {
+		f.t.Fatal("unexpected UpdateService call")
+	}
+	return f.updateService(s)
+}
+
+func (f *fakeClient) DeleteServiceWithContext(ctx context.Context, id string) error {
+	if f.deleteService == nil {
+		f.t.Fatal("unexpected DeleteService call")
+	}
+	return f.deleteService(id)
+}
+
+func (f *fakeClient) GetIntegrationWithContext(ctx context.Context, serviceID string, integrationID string, o pdApi.GetIntegrationOptions) (*pdApi.Integration, error) {
+	if f.getIntegration == nil {
+		f.t.Fatal("unexpected GetIntegration call")
+	}
+	return f.getIntegration(serviceID, integrationID, o)
+}
+
+func (f *fakeClient) CreateIntegrationWithContext(ctx context.Context, id string, i pdApi.Integration) (*pdApi.Integration, error) {
+	if f.createIntegration == nil {
+		f.t.Fatal("unexpected CreateIntegration call")
+	}
+	return f.createIntegration(id, i)
+}
+
+func (f *fakeClient) DeleteIntegrationWithContext(ctx context.Context, serviceID string, integrationID string) error {
+	if f.deleteIntegration == nil {
+		f.t.Fatal("unexpected DeleteIntegration call")
+	}
+	return f.deleteIntegration(serviceID, integrationID)
+}
+
+func (f *fakeClient) GetEscalationPolicyWithContext(ctx context.Context, id string, o *pdApi.GetEscalationPolicyOptions) (*pdApi.EscalationPolicy, error) {
+	if f.getEscalationPolicy == nil {
+		f.t.Fatal("unexpected GetEscalationPolicy call")
+	}
+	return f.getEscalationPolicy(id, o)
+}
+
+func (f *fakeClient) ListEscalationPoliciesWithContext(ctx context.Context, o pdApi.ListEscalationPoliciesOptions) (*pdApi.ListEscalationPoliciesResponse, error) {
+	if f.listEscalationPolicies == nil {
+		f.t.Fatal("unexpected ListEscalationPolicies call")
+	}
+	return f.listEscalationPolicies(o)
+}
+
+func (f *fakeClient) CreateEscalationPolicyWithContext(ctx context.Context, e pdApi.EscalationPolicy) (*pdApi.EscalationPolicy, error) {
+	if f.createEscalationPolicy == nil {
+		f.t.Fatal("unexpected CreateEscalationPolicy call")
+	}
+	return f.createEscalationPolicy(e)
+}
+
+func (f *fakeClient) GetTeamWithContext(ctx context.Context, id string) (*pdApi.Team, error) {
+	if f.getTeam == nil {
+		f.t.Fatal("unexpected GetTeam call")
+	}
+	return f.getTeam(id)
+}
+
+func (f *fakeClient) GetVendorWithContext(ctx context.Context, id string) (*pdApi.Vendor, error) {
+	if f.getVendor == nil {
+		f.t.Fatal("unexpected GetVendor call")
+	}
+	return f.getVendor(id)
+}
+
+func (f *fakeClient) CreateMaintenanceWindowsWithContext(ctx context.Context, m pdApi.MaintenanceWindow) (*pdApi.MaintenanceWindow, error) {
+	if f.createMaintenanceWindows == nil {
+		f.t.Fatal("unexpected CreateMaintenanceWindows call")
+	}
+	return f.createMaintenanceWindows(m)
+}
+
+func (f *fakeClient) ListIncidentsWithContext(ctx context.Context, o pdApi.ListIncidentsOptions) (*pdApi.ListIncidentsResponse, error) {
+	if f.listIncidents == nil {
+		f.t.Fatal("unexpected ListIncidents call")
+	}
+	return f.listIncidents(o)
+}
+
+func (f *fakeClient) ManageIncidentsWithContext(ctx context.Context, from string, incidents []pdApi.Incident) error {
+	if f.manageIncidents == nil {
+		f.t.Fatal("unexpected ManageIncidents call")
+	}
+	return f.manageIncidents(from, incidents)
+}
+
+// testData returns a Data wired to the fake client and to a stub HTTP server
+// that accepts raw api calls like tag assignment. The caller must invoke the
+// returned cleanup function.
+func testData(t *testing.T, client *fakeClient) (*Data, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+
+	data := &Data{
+		APIKey:             "test-api-key",
+		ClusterID:          "test-cluster",
+		BaseDomain:         "example.com",
+		servicePrefix:      "osd",
+		escalationPolicyID: "PPOLICY",
+		alertCreation:      "create_alerts_and_incidents",
+		Integrations: []IntegrationSpec{
+			{Name: "V4 Alertmanager", Type: "events_api_v2_inbound_integration"},
+		},
+		apiEndpoint:      server.URL,
+		MaxRetryAttempts: 2,
+		retryBaseDelay:   time.Millisecond,
+		client:           client,
+	}
+	return data, server.Close
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// sharedConfig is the last successfully parsed PD config. It is replaced
+// wholesale on reload so readers always see a complete snapshot, never a
+// half-parsed one.
+var (
+	sharedConfig    *Data
+	sharedConfigMux sync.Mutex
+)
+
+// SharedConfig returns the most recently loaded config snapshot, or nil when
+// no reload has succeeded yet. Callers must treat the returned Data as
+// read-only and take a fresh snapshot per reconcile rather than holding on
+// to one.
+func SharedConfig() *Data {
+	sharedConfigMux.Lock()
+	defer sharedConfigMux.Unlock()
+
+	return sharedConfig
+}
+
+// ConfigureFromShared copies the PD secret configuration from the shared
+// snapshot into data, leaving identity fields like ClusterID and BaseDomain
+// untouched. It reports false when no snapshot has been loaded yet, in which
+// case the caller should fall back to ParsePDConfig.
+func (data *Data) ConfigureFromShared() bool {
+	snapshot := SharedConfig()
+	if snapshot == nil {
+		return false
+	}
+
+	data.authType = snapshot.authType
+	data.APIKey = snapshot.APIKey
+	data.secondaryAPIKey = snapshot.secondaryAPIKey
+	data.escalationPolicyID = snapshot.escalationPolicyID
+	data.escalationPolicyIsName = snapshot.escalationPolicyIsName
+	data.autoResolveTimeout = snapshot.autoResolveTimeout
+	data.acknowledgeTimeOut = snapshot.acknowledgeTimeOut
+	data.servicePrefix = snapshot.servicePrefix
+	data.alertCreation = snapshot.alertCreation
+	data.serviceNameTemplate = snapshot.serviceNameTemplate
+	data.teamID = snapshot.teamID
+	data.integrationName = snapshot.integrationName
+	data.integrationType = snapshot.integrationType
+	data.integrationVendorID = snapshot.integrationVendorID
+	data.apiEndpoint = snapshot.apiEndpoint
+	data.incidentUrgency = snapshot.incidentUrgency
+	data.supportHours = snapshot.supportHours
+	data.urgencyDuringSupport = snapshot.urgencyDuringSupport
+	data.urgencyOutsideSupport = snapshot.urgencyOutsideSupport
+	data.alertGrouping = snapshot.alertGrouping
+	data.alertGroupingTimeout = snapshot.alertGroupingTimeout
+	data.createEscalationPolicy = snapshot.createEscalationPolicy
+	if len(data.Integrations) == 0 {
+		data.Integrations = snapshot.Integrations
+	}
+
+	return true
+}
+
+// ReloadSharedConfig parses the PD secret into a fresh Data and publishes it
+// as the shared snapshot. On a parse error the previous snapshot stays in
+// place so a bad edit to the secret does not take the operator down.
+func ReloadSharedConfig(osc client.Client) error {
+	data := &Data{}
+	if err := data.ParsePDConfig(osc); err != nil {
+		return err
+	}
+
+	sharedConfigMux.Lock()
+	sharedConfig = data
+	sharedConfigMux.Unlock()
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+)
+
+// dependencyRef identifies one side of a service dependency
+type dependencyRef struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// serviceDependency mirrors one relationship in the service dependencies api
+type serviceDependency struct {
+	SupportingService dependencyRef `json:"supporting_service"`
+	DependentService  dependencyRef `json:"dependent_service"`
+}
+
+// dependencyPayload is the request and response shape of the associate and
+// disassociate endpoints
+type dependencyPayload struct {
+	Relationships []serviceDependency `json:"relationships"`
+}
+
+// dependencyRelationship builds the relationship linking this cluster's
+// service as supporting the given business service
+func (data *Data) dependencyRelationship(businessServiceID string) serviceDependency {
+	return serviceDependency{
+		SupportingService: dependencyRef{ID: data.ServiceID, Type: "service_reference"},
+		DependentService:  dependencyRef{ID: businessServiceID, Type: "business_service_reference"},
+	}
+}
+
+// hasServiceDependency reports whether this cluster's service already
+// supports the given business service
+func (data *Data) hasServiceDependency(ctx context.Context, businessServiceID string) (bool, error) {
+	var resp dependencyPayload
+	err := data.apiRequest(ctx, "GET", "/service_dependencies/technical_services/"+data.ServiceID, nil, &resp)
+	if err != nil {
+		return false, err
+	}
+
+	for _, rel := range resp.Relationships {
+		if rel.DependentService.ID == businessServiceID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AddServiceDependency links this cluster's service as a supporting service
+// of the given business service so incidents roll up the monitoring
+// hierarchy. Linking an existing dependency is a no-op.
+func (data *Data) AddServiceDependency(ctx context.Context, businessServiceID string) error {
+	exists, err := data.hasServiceDependency(ctx, businessServiceID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	payload := dependencyPayload{
+		Relationships: []serviceDependency{data.dependencyRelationship(businessServiceID)},
+	}
+	return data.apiRequest(ctx, "POST", "/service_dependencies/associate", payload, nil)
+}
+
+// RemoveServiceDependency unlinks this cluster's service from the given
+// business service, e.g. before the service is deleted. Removing a
+// dependency that does not exist is a no-op.
+func (data *Data) RemoveServiceDependency(ctx context.Context, businessServiceID string) error {
+	exists, err := data.hasServiceDependency(ctx, businessServiceID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	payload := dependencyPayload{
+		Relationships: []serviceDependency{data.dependencyRelationship(businessServiceID)},
+	}
+	return data.apiRequest(ctx, "POST", "/service_dependencies/disassociate", payload, nil)
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/pagerduty-operator/pkg/pdcompat"
+)
+
+var (
+	// ErrServiceNameTaken is returned when PagerDuty rejects a create because a service with the same name already exists
+	ErrServiceNameTaken = errors.New("service name has already been taken")
+	// ErrServiceNotFound is returned when the requested service does not exist in PagerDuty
+	ErrServiceNotFound = errors.New("service not found in PagerDuty")
+	// ErrEscalationPolicyNotFound is returned when the configured escalation policy does not exist in PagerDuty
+	ErrEscalationPolicyNotFound = errors.New("escalation policy not found in PagerDuty")
+	// ErrIntegrationNotFound is returned when the requested integration does not exist on the service
+	ErrIntegrationNotFound = errors.New("integration not found in PagerDuty")
+)
+
+// httpStatusRE extracts the status code from errors built by the raw
+// apiRequest path, which only surfaces it in the message text
+var httpStatusRE = regexp.MustCompile(`HTTP response code: (\d+)`)
+
+// errStatusCode returns the HTTP status embedded in an api error, or 0 when
+// the error carries no status. Client errors expose it structurally; the raw
+// apiRequest path still needs the text parsed.
+func errStatusCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var apiErr *pdcompat.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	match := httpStatusRE.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	code, _ := strconv.Atoi(match[1])
+	return code
+}
+
+// wrapCreateServiceError maps an error from the service create call onto the
+// typed sentinels so callers can use errors.Is instead of matching message text
+func wrapCreateServiceError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if strings.Contains(err.Error(), "Name has already been taken") {
+		return fmt.Errorf("%w: %v", ErrServiceNameTaken, err)
+	}
+	return err
+}
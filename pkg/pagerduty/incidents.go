@@ -0,0 +1,82 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+
+	pdApi "github.com/PagerDuty/go-pagerduty"
+)
+
+// openIncidents returns the incidents on this cluster's service that are
+// still triggered or acknowledged
+func (data *Data) openIncidents(ctx context.Context) ([]pdApi.Incident, error) {
+	client := data.getClient()
+
+	var open []pdApi.Incident
+	opts := pdApi.ListIncidentsOptions{
+		ServiceIDs: []string{data.ServiceID},
+		Statuses:   []string{"triggered", "acknowledged"},
+	}
+	for {
+		var resp *pdApi.ListIncidentsResponse
+		err := data.retryCall(ctx, func() error {
+			var callErr error
+			resp, callErr = client.ListIncidentsWithContext(ctx, opts)
+			return callErr
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		open = append(open, resp.Incidents...)
+		if !resp.More {
+			break
+		}
+		opts.Offset = resp.Offset + resp.Limit
+	}
+
+	return open, nil
+}
+
+// ResolveOpenIncidents resolves every open incident on this cluster's
+// service, e.g. before a forced delete. The FromEmail identity is sent to
+// the api as the acting user.
+func (data *Data) ResolveOpenIncidents(ctx context.Context) error {
+	open, err := data.openIncidents(ctx)
+	if err != nil {
+		return err
+	}
+	if len(open) == 0 {
+		return nil
+	}
+
+	resolved := make([]pdApi.Incident, 0, len(open))
+	for _, incident := range open {
+		resolved = append(resolved, pdApi.Incident{
+			APIObject: pdApi.APIObject{
+				ID:   incident.ID,
+				Type: "incident_reference",
+			},
+			Status: "resolved",
+		})
+	}
+
+	log.Info("Resolving open incidents", "ServiceID", data.ServiceID, "Incidents", len(resolved))
+	client := data.getClient()
+	return data.retryCall(ctx, func() error {
+		return client.ManageIncidentsWithContext(ctx, data.FromEmail, resolved)
+	})
+}
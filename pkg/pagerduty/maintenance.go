@@ -0,0 +1,59 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pdApi "github.com/PagerDuty/go-pagerduty"
+)
+
+// CreateMaintenanceWindow opens a maintenance window over this cluster's
+// service so alerts are suppressed, e.g. while the cluster is upgrading. It
+// returns the ID of the created window.
+func (data *Data) CreateMaintenanceWindow(ctx context.Context, start time.Time, end time.Time, description string) (string, error) {
+	if !end.After(start) {
+		return "", errors.New("maintenance window end must be after its start")
+	}
+	if end.Before(time.Now()) {
+		return "", errors.New("maintenance window is entirely in the past")
+	}
+
+	client := data.getClient()
+
+	window := pdApi.MaintenanceWindow{
+		StartTime:   start.Format(time.RFC3339),
+		EndTime:     end.Format(time.RFC3339),
+		Description: description,
+		Services: []pdApi.APIObject{{
+			ID:   data.ServiceID,
+			Type: "service_reference",
+		}},
+	}
+
+	var created *pdApi.MaintenanceWindow
+	err := data.retryCall(ctx, func() error {
+		var callErr error
+		created, callErr = client.CreateMaintenanceWindowsWithContext(ctx, window)
+		return callErr
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return created.ID, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/openshift/pagerduty-operator/pkg/pdcompat"
+)
+
+// retryAfterRE extracts the Retry-After hint that the raw apiRequest path
+// carries in its error text
+var retryAfterRE = regexp.MustCompile(`Retry-After: (\d+)`)
+
+// errRetryAfter returns how long the api asked us to wait before retrying a
+// rate limited call, when the error carries that information. Client errors
+// carry the header structurally; the raw apiRequest path embeds it in the
+// message.
+func errRetryAfter(err error) (time.Duration, bool) {
+	if err == nil || errStatusCode(err) != http.StatusTooManyRequests {
+		return 0, false
+	}
+	var apiErr *pdcompat.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.RetryAfter <= 0 {
+			return 0, false
+		}
+		return time.Duration(apiErr.RetryAfter) * time.Second, true
+	}
+	match := retryAfterRE.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, false
+	}
+	seconds, convErr := strconv.Atoi(match[1])
+	if convErr != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+const (
+	defaultMaxAttempts    = 4
+	defaultRetryBaseDelay = 2 * time.Second
+)
+
+// isRetryable reports whether an api error is worth retrying: rate limits,
+// server-side failures and network errors. Client errors like 400, 403 and
+// 404 fail immediately.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	code := errStatusCode(err)
+	switch {
+	case code == http.StatusTooManyRequests:
+		return true
+	case code >= 500:
+		return true
+	case code != 0:
+		return false
+	}
+
+	// No embedded status means the call never got a response, e.g. a
+	// connection reset.
+	return true
+}
+
+// retryCall retries transient api failures with exponential backoff and
+// jitter, honoring ctx cancellation between attempts
+func (data *Data) retryCall(ctx context.Context, call func() error) error {
+	maxAttempts := data.MaxRetryAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	baseDelay := data.retryBaseDelay
+	if baseDelay <= 0 {
+		baseDelay = defaultRetryBaseDelay
+	}
+
+	if err := data.getBreaker().allow(); err != nil {
+		return err
+	}
+
+	var err error
+	attempt := 0
+	for {
+		err = call()
+		data.getBreaker().record(err)
+		if err == nil {
+			data.noteAuthSuccess()
+			return nil
+		}
+		if errStatusCode(err) == http.StatusUnauthorized && data.fallbackToSecondaryKey() {
+			// The fallback key gets an immediate extra attempt: no
+			// backoff and no charge against the retry budget.
+			// fallbackToSecondaryKey only reports true once, so this
+			// cannot loop.
+			continue
+		}
+		if !isRetryable(err) {
+			return err
+		}
+
+		attempt++
+		if attempt >= maxAttempts {
+			return err
+		}
+
+		delay := baseDelay << uint(attempt-1)
+		delay += time.Duration(rand.Int63n(int64(delay)))
+		if retryAfter, ok := errRetryAfter(err); ok {
+			// The api told us exactly how long to back off.
+			delay = retryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openshift/pagerduty-operator/pkg/pdcompat"
+)
+
+func TestRetryCallRetriesTransientErrors(t *testing.T) {
+	data := &Data{
+		MaxRetryAttempts: 4,
+		retryBaseDelay:   time.Millisecond,
+	}
+
+	calls := 0
+	err := data.retryCall(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("Failed call API endpoint. HTTP response code: 503. Error: upstream down")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("retryCall returned error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %v", calls)
+	}
+}
+
+func TestRetryCallDoesNotRetryClientErrors(t *testing.T) {
+	data := &Data{
+		MaxRetryAttempts: 4,
+		retryBaseDelay:   time.Millisecond,
+	}
+
+	calls := 0
+	err := data.retryCall(context.Background(), func() error {
+		calls++
+		return errors.New("Failed call API endpoint. HTTP response code: 404. Error: not found")
+	})
+	if err == nil {
+		t.Fatal("expected the 404 to be returned")
+	}
+	if calls != 1 {
+		t.Errorf("expected a single call for a non-retryable error, got %v", calls)
+	}
+}
+
+func TestRetryCallTriesSecondaryKeyWithoutSpendingAnAttempt(t *testing.T) {
+	data := &Data{
+		APIKey:           "primary",
+		secondaryAPIKey:  "secondary",
+		MaxRetryAttempts: 1,
+		retryBaseDelay:   time.Millisecond,
+	}
+
+	calls := 0
+	err := data.retryCall(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			return errors.New("Failed call API endpoint. HTTP response code: 401. Error: unauthorized")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("retryCall returned error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the fallback key to be tried even with a single attempt, got %v calls", calls)
+	}
+	if !data.usingSecondaryKey {
+		t.Error("expected the secondary key to be in use")
+	}
+}
+
+func TestRetryCallGivesUpAfterMaxAttempts(t *testing.T) {
+	data := &Data{
+		MaxRetryAttempts: 3,
+		retryBaseDelay:   time.Millisecond,
+	}
+
+	calls := 0
+	transient := errors.New("Failed call API endpoint. HTTP response code: 502. Error: bad gateway")
+	err := data.retryCall(context.Background(), func() error {
+		calls++
+		return transient
+	})
+	if err == nil {
+		t.Fatal("expected the transient error to surface after the attempts run out")
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %v", calls)
+	}
+}
+
+func TestErrRetryAfter(t *testing.T) {
+	err := errors.New("failed call API endpoint /services. HTTP response code: 429. Retry-After: 7")
+	delay, ok := errRetryAfter(err)
+	if !ok {
+		t.Fatal("expected a Retry-After hint to be found")
+	}
+	if delay != 7*time.Second {
+		t.Errorf("expected a 7s delay, got %v", delay)
+	}
+
+	if _, ok := errRetryAfter(errors.New("Failed call API endpoint. HTTP response code: 500. Error: x")); ok {
+		t.Error("expected no Retry-After hint on a 500")
+	}
+}
+
+func TestErrRetryAfterStructured(t *testing.T) {
+	err := fmt.Errorf("updating service: %w", &pdcompat.APIError{StatusCode: 429, RetryAfter: 12})
+	delay, ok := errRetryAfter(err)
+	if !ok {
+		t.Fatal("expected the Retry-After field to be found through the wrap")
+	}
+	if delay != 12*time.Second {
+		t.Errorf("expected a 12s delay, got %v", delay)
+	}
+
+	if _, ok := errRetryAfter(&pdcompat.APIError{StatusCode: 429}); ok {
+		t.Error("expected no hint when the response carried no Retry-After header")
+	}
+}
@@ -15,18 +15,148 @@
 package pagerduty
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	pdApi "github.com/PagerDuty/go-pagerduty"
+	"github.com/openshift/pagerduty-operator/config"
+	"github.com/openshift/pagerduty-operator/pkg/metrics"
+	"github.com/openshift/pagerduty-operator/pkg/pdcompat"
+	"github.com/openshift/pagerduty-operator/pkg/tracing"
+	"github.com/openshift/pagerduty-operator/version"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 )
 
+var log = logf.Log.WithName("pagerduty_service")
+
+// servicePrefixRE restricts SERVICE_PREFIX to characters that produce sane
+// PagerDuty service names
+var servicePrefixRE = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+const defaultAPIEndpoint = "https://api.pagerduty.com"
+
+// clusterIDRE matches the UUID-like cluster names hive hands us: lowercase
+// alphanumerics and hyphens, not starting or ending with a hyphen
+var clusterIDRE = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// baseDomainRE matches a plausible DNS name: dot-separated labels of
+// alphanumerics and hyphens, not starting or ending with a hyphen
+var baseDomainRE = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+// dryRunIntegrationKey is the placeholder returned by CreateService when
+// DryRun is set
+const dryRunIntegrationKey = "dry-run-integration-key"
+
+// userAgent identifies the operator (and its version) to the PagerDuty
+// api, so admins can tell our calls apart from other tooling
+func userAgent() string {
+	return "pagerduty-operator/" + version.Version
+}
+
+// authHeader returns the Authorization header value matching the
+// configured auth type
+func (data *Data) authHeader() string {
+	if data.authType == "oauth" {
+		return "Bearer " + data.APIKey
+	}
+	return "Token token=" + data.APIKey
+}
+
+// finishSpan closes a tracing span, marking it failed when the operation
+// returned an error
+func finishSpan(span tracing.Span, err error) {
+	if err != nil {
+		span.SetTag("error", true)
+		span.LogKV("message", err.Error())
+	}
+	span.Finish()
+}
+
+// httpClient returns the http client to use for api requests
+func (data *Data) httpClient() *http.Client {
+	if data.HTTPClient != nil {
+		return data.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// endpoint returns the PagerDuty api endpoint to talk to, allowing EU and
+// on-prem deployments to override the default US one
+func (data *Data) endpoint() string {
+	if data.apiEndpoint != "" {
+		return data.apiEndpoint
+	}
+	return defaultAPIEndpoint
+}
+
+// apiRequest performs a raw call against the PagerDuty REST api for endpoints
+// the vendored client does not expose. It goes through retryCall, so the
+// circuit breaker, backoff (including Retry-After hints) and secondary key
+// fallback apply the same as for client library calls.
+func (data *Data) apiRequest(ctx context.Context, method string, path string, payload interface{}, result interface{}) error {
+	return data.retryCall(ctx, func() error {
+		return data.doAPIRequest(ctx, method, path, payload, result)
+	})
+}
+
+func (data *Data) doAPIRequest(ctx context.Context, method string, path string, payload interface{}, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(encoded)
+	}
+
+	req, err := http.NewRequest(method, data.endpoint()+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", data.authHeader())
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := data.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if 199 >= resp.StatusCode || 300 <= resp.StatusCode {
+		// Carry the Retry-After header in the error text so the retry
+		// logic can honor the api's rate limiting.
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			return fmt.Errorf("failed call API endpoint %v. HTTP response code: %v. Retry-After: %v", path, resp.StatusCode, retryAfter)
+		}
+		return fmt.Errorf("failed call API endpoint %v. HTTP response code: %v", path, resp.StatusCode)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
 func getConfigMapKey(data map[string]string, key string) (string, error) {
 	if _, ok := data[key]; !ok {
 		errorStr := fmt.Sprintf("%v does not exist", key)
@@ -65,32 +195,258 @@ func convertStrToUint(value string) (uint, error) {
 	return retVal, nil
 }
 
+// parseTimeout interprets a timeout value from the PD secret. The special
+// value "disabled" (or an empty value) turns the timeout off entirely, which
+// PagerDuty represents as a nil pointer.
+func parseTimeout(value string) (*uint, error) {
+	if value == "" || value == "disabled" {
+		return nil, nil
+	}
+
+	parsed, err := convertStrToUint(value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// validateTimeoutRange enforces the bounds PagerDuty accepts for service
+// timeouts so a bad value fails at config parse instead of at service
+// creation. A nil (disabled) timeout is always valid.
+func validateTimeoutRange(key string, value *uint) error {
+	if value == nil {
+		return nil
+	}
+	if *value < 60 || *value > 86400 {
+		return fmt.Errorf("%v must be between 60 and 86400, got %v", key, *value)
+	}
+	return nil
+}
+
+func uintPtrEqual(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// validIntegrationTypes are the integration types the PagerDuty api accepts
+var validIntegrationTypes = map[string]bool{
+	"aws_cloudwatch_inbound_integration":        true,
+	"cloudkick_inbound_integration":             true,
+	"event_transformer_api_inbound_integration": true,
+	"events_api_v2_inbound_integration":         true,
+	"generic_email_inbound_integration":         true,
+	"generic_events_api_inbound_integration":    true,
+	"keynote_inbound_integration":               true,
+	"nagios_inbound_integration":                true,
+	"pingdom_inbound_integration":               true,
+	"sql_monitor_inbound_integration":           true,
+}
+
+// IntegrationSpec describes an integration to create on a service
+type IntegrationSpec struct {
+	Name string
+	Type string
+}
+
 // Data describes the data that is needed for PagerDuty api calls
 type Data struct {
-	escalationPolicyID string
-	autoResolveTimeout uint
-	acknowledgeTimeOut uint
-	servicePrefix      string
-	APIKey             string
-	ClusterID          string
-	BaseDomain         string
+	escalationPolicyID  string
+	autoResolveTimeout  *uint
+	acknowledgeTimeOut  *uint
+	servicePrefix       string
+	alertCreation       string
+	serviceNameTemplate string
+	teamID              string
+	integrationName     string
+	integrationType     string
+	integrationVendorID string
+	apiEndpoint         string
+	incidentUrgency     string
+	authType            string
+
+	// secondaryAPIKey is tried when the primary key is rejected with a
+	// 401, so keys can be rotated without downtime
+	secondaryAPIKey string
+	// usingSecondaryKey records that calls are authenticating with the
+	// secondary key
+	usingSecondaryKey bool
+	// secondaryKeySuccessLogged keeps the fallback notice to one log line
+	secondaryKeySuccessLogged bool
+
+	// escalationPolicyIsName marks the configured escalation policy as a
+	// human-readable name that still needs resolving to an ID
+	escalationPolicyIsName bool
+
+	alertGrouping        string
+	alertGroupingTimeout uint
+
+	supportHours          *pdApi.SupportHours
+	urgencyDuringSupport  string
+	urgencyOutsideSupport string
+	// createEscalationPolicy allows bootstrapping a default escalation
+	// policy when the configured one does not exist
+	createEscalationPolicy bool
+	APIKey                 string
+	ClusterID              string
+	BaseDomain             string
+
+	// SecretNamespace and SecretName locate the PD api secret. They
+	// default to the operator namespace and pagerduty-api-key for
+	// backward compatibility.
+	SecretNamespace string
+	SecretName      string
+
+	// Integrations are the integrations to create on the service. When
+	// empty it defaults to the single integration from the PD secret.
+	Integrations []IntegrationSpec
 
 	ServiceID     string
 	IntegrationID string
+	// IntegrationIDs maps integration names, in the sanitized form produced
+	// by IntegrationConfigMapKey, to their IDs on the service
+	IntegrationIDs map[string]string
+
+	// HTTPClient is used for requests against the PagerDuty api, so
+	// deployments with flaky egress can set a timeout and tune the
+	// connection pool. When unset http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// MaxRetryAttempts bounds retries of transient api failures. Zero
+	// means the package default.
+	MaxRetryAttempts int
+
+	// FromEmail is the acting user sent to the api on incident write
+	// operations such as resolving open incidents
+	FromEmail string
+
+	// DryRun makes CreateService and DeleteService log what they would do
+	// and return without calling the api, so a new config can be validated
+	// before going live
+	DryRun bool
+	// retryBaseDelay is the starting backoff between retry attempts,
+	// overridable for fast tests
+	retryBaseDelay time.Duration
+
+	client    pdClient
+	clientMux sync.Mutex
+
+	// breaker fast-fails api calls while PagerDuty keeps erroring
+	breaker    *breaker
+	breakerMux sync.Mutex
+
+	// serviceCache holds the last GetService result per service ID for a
+	// short window so repeated gets within one reconcile skip the round
+	// trip
+	serviceCache    map[string]cachedService
+	serviceCacheMux sync.Mutex
+}
+
+// getClient returns the shared PagerDuty api client, creating it on first use.
+// Reconciles may run concurrently so access to the cached client is serialized.
+func (data *Data) getClient() pdClient {
+	data.clientMux.Lock()
+	defer data.clientMux.Unlock()
+
+	if data.client == nil {
+		options := []pdcompat.ClientOptions{
+			pdcompat.WithAPIEndpoint(data.endpoint()),
+			pdcompat.WithHTTPClient(data.httpClient()),
+			pdcompat.WithUserAgent(userAgent()),
+		}
+		if data.authType == "oauth" {
+			data.client = pdcompat.NewOAuthClient(data.APIKey, options...)
+		} else {
+			data.client = pdcompat.NewClient(data.APIKey, options...)
+		}
+	}
+
+	return data.client
+}
+
+// fallbackToSecondaryKey swaps in the secondary api key after the primary
+// was rejected, dropping the cached client so the next call authenticates
+// with the new key. It reports whether a retry is worthwhile, i.e. a
+// secondary key is configured and not already in use.
+func (data *Data) fallbackToSecondaryKey() bool {
+	data.clientMux.Lock()
+	defer data.clientMux.Unlock()
+
+	if data.secondaryAPIKey == "" || data.usingSecondaryKey {
+		return false
+	}
+
+	log.Info("Primary PagerDuty api key was rejected, falling back to the secondary key")
+	data.APIKey = data.secondaryAPIKey
+	data.usingSecondaryKey = true
+	data.client = nil
+	return true
+}
+
+// noteAuthSuccess logs, once, that calls are succeeding with the secondary
+// api key so the primary can be retired. Key values are never logged.
+func (data *Data) noteAuthSuccess() {
+	data.clientMux.Lock()
+	defer data.clientMux.Unlock()
+
+	if data.usingSecondaryKey && !data.secondaryKeySuccessLogged {
+		log.Info("PagerDuty call succeeded with the secondary api key, the primary key can be retired")
+		data.secondaryKeySuccessLogged = true
+	}
 }
 
 // ParsePDConfig parses the PD secret and stores it in the struct
 func (data *Data) ParsePDConfig(osc client.Client) error {
 
+	secretNamespace := data.SecretNamespace
+	if secretNamespace == "" {
+		secretNamespace = config.OperatorNamespace
+	}
+	secretName := data.SecretName
+	if secretName == "" {
+		secretName = "pagerduty-api-key"
+	}
+
 	pdAPISecret := &corev1.Secret{}
-	err := osc.Get(context.TODO(), types.NamespacedName{Namespace: "pagerduty-operator", Name: "pagerduty-api-key"}, pdAPISecret)
+	err := osc.Get(context.TODO(), types.NamespacedName{Namespace: secretNamespace, Name: secretName}, pdAPISecret)
 	if err != nil {
-		return err
+		// Deployments that inject the api key through the environment
+		// may not have the secret at all.
+		if os.Getenv("PAGERDUTY_API_KEY") == "" {
+			return err
+		}
+	}
+
+	data.authType, err = getSecretKey(pdAPISecret.Data, "PAGERDUTY_AUTH_TYPE")
+	if err != nil {
+		data.authType = "apikey"
+	}
+	if data.authType != "apikey" && data.authType != "oauth" {
+		return fmt.Errorf("PAGERDUTY_AUTH_TYPE must be apikey or oauth, got %v", data.authType)
 	}
 
 	data.APIKey, err = getSecretKey(pdAPISecret.Data, "PAGERDUTY_API_KEY")
 	if err != nil {
-		return err
+		// The secret stays the primary source; the environment is only
+		// consulted when it does not provide the key.
+		if envKey := os.Getenv("PAGERDUTY_API_KEY"); envKey != "" {
+			data.APIKey = envKey
+		} else {
+			return err
+		}
+	}
+	if data.authType == "oauth" {
+		// A dedicated oauth token key wins; otherwise the token is read
+		// from the existing api key field.
+		if oauthToken, tokenErr := getSecretKey(pdAPISecret.Data, "PAGERDUTY_OAUTH_TOKEN"); tokenErr == nil {
+			data.APIKey = oauthToken
+		}
+	}
+
+	data.secondaryAPIKey, err = getSecretKey(pdAPISecret.Data, "PAGERDUTY_API_KEY_SECONDARY")
+	if err != nil {
+		data.secondaryAPIKey = ""
 	}
 
 	data.escalationPolicyID, err = getSecretKey(pdAPISecret.Data, "ESCALATION_POLICY")
@@ -98,139 +454,1328 @@ func (data *Data) ParsePDConfig(osc client.Client) error {
 		return err
 	}
 
-	autoResolveTimeoutStr, err := getSecretKey(pdAPISecret.Data, "RESOLVE_TIMEOUT")
+	escalationPolicyIsName, err := getSecretKey(pdAPISecret.Data, "ESCALATION_POLICY_IS_NAME")
+	data.escalationPolicyIsName = err == nil && escalationPolicyIsName == "true"
+
+	autoResolveTimeoutStr, ok := pdAPISecret.Data["RESOLVE_TIMEOUT"]
+	if !ok {
+		autoResolveTimeoutStr = []byte("14400")
+	}
+	data.autoResolveTimeout, err = parseTimeout(string(autoResolveTimeoutStr))
 	if err != nil {
 		return err
 	}
-	data.autoResolveTimeout, err = convertStrToUint(autoResolveTimeoutStr)
-	if err != nil {
+	if err := validateTimeoutRange("RESOLVE_TIMEOUT", data.autoResolveTimeout); err != nil {
 		return err
 	}
 
-	acknowledgeTimeStr, err := getSecretKey(pdAPISecret.Data, "ACKNOWLEDGE_TIMEOUT")
+	acknowledgeTimeStr, ok := pdAPISecret.Data["ACKNOWLEDGE_TIMEOUT"]
+	if !ok {
+		acknowledgeTimeStr = []byte("600")
+	}
+	data.acknowledgeTimeOut, err = parseTimeout(string(acknowledgeTimeStr))
 	if err != nil {
 		return err
 	}
-	data.acknowledgeTimeOut, err = convertStrToUint(acknowledgeTimeStr)
-	if err != nil {
+	if err := validateTimeoutRange("ACKNOWLEDGE_TIMEOUT", data.acknowledgeTimeOut); err != nil {
 		return err
 	}
 
 	data.servicePrefix, err = getSecretKey(pdAPISecret.Data, "SERVICE_PREFIX")
 	if err != nil {
 		data.servicePrefix = "osd"
+	} else if !servicePrefixRE.MatchString(data.servicePrefix) {
+		return fmt.Errorf("SERVICE_PREFIX must contain only lowercase alphanumeric characters and hyphens, got %v", data.servicePrefix)
 	}
 
-	return nil
-}
+	data.alertCreation, err = getSecretKey(pdAPISecret.Data, "ALERT_CREATION")
+	if err != nil {
+		data.alertCreation = "create_alerts_and_incidents"
+	}
+	if data.alertCreation != "create_alerts_and_incidents" && data.alertCreation != "create_incidents" {
+		return fmt.Errorf("ALERT_CREATION must be either create_alerts_and_incidents or create_incidents, got %v", data.alertCreation)
+	}
 
-// ParseClusterConfig parses the cluster specific config map and stores the IDs in the data struct
-func (data *Data) ParseClusterConfig(osc client.Client, namespace string, name string) error {
-	pdAPIConfigMap := &corev1.ConfigMap{}
-	err := osc.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name + "-pd-config"}, pdAPIConfigMap)
+	data.serviceNameTemplate, err = getSecretKey(pdAPISecret.Data, "SERVICE_NAME_TEMPLATE")
 	if err != nil {
-		return err
+		data.serviceNameTemplate = ""
 	}
 
-	data.ServiceID, err = getConfigMapKey(pdAPIConfigMap.Data, "SERVICE_ID")
+	data.teamID, err = getSecretKey(pdAPISecret.Data, "TEAM_ID")
 	if err != nil {
-		return err
+		data.teamID = ""
 	}
 
-	data.IntegrationID, err = getConfigMapKey(pdAPIConfigMap.Data, "INTEGRATION_ID")
+	data.integrationName, err = getSecretKey(pdAPISecret.Data, "INTEGRATION_NAME")
+	if err != nil {
+		data.integrationName = "V4 Alertmanager"
+	}
+
+	data.integrationType, err = getSecretKey(pdAPISecret.Data, "INTEGRATION_TYPE")
+	if err != nil {
+		data.integrationType = "events_api_v2_inbound_integration"
+	}
+	if !validIntegrationTypes[data.integrationType] {
+		return fmt.Errorf("INTEGRATION_TYPE %v is not a valid PagerDuty integration type", data.integrationType)
+	}
+
+	data.integrationVendorID, err = getSecretKey(pdAPISecret.Data, "INTEGRATION_VENDOR_ID")
+	if err != nil {
+		data.integrationVendorID = ""
+	}
+
+	data.apiEndpoint, err = getSecretKey(pdAPISecret.Data, "API_ENDPOINT")
+	if err != nil {
+		data.apiEndpoint = ""
+	}
+
+	data.incidentUrgency, err = getSecretKey(pdAPISecret.Data, "INCIDENT_URGENCY")
 	if err != nil {
+		data.incidentUrgency = ""
+	}
+	switch data.incidentUrgency {
+	case "", "high", "low", "severity_based", "use_support_hours":
+	default:
+		return fmt.Errorf("INCIDENT_URGENCY must be one of high, low, severity_based or use_support_hours, got %v", data.incidentUrgency)
+	}
+
+	if err := data.parseSupportHours(pdAPISecret.Data); err != nil {
 		return err
 	}
 
+	data.alertGrouping, err = getSecretKey(pdAPISecret.Data, "ALERT_GROUPING")
+	if err != nil {
+		data.alertGrouping = ""
+	}
+	switch data.alertGrouping {
+	case "", "time", "intelligent", "content_based":
+	default:
+		return fmt.Errorf("ALERT_GROUPING must be one of time, intelligent or content_based, got %v", data.alertGrouping)
+	}
+	if data.alertGrouping == "time" {
+		groupingTimeoutStr, err := getSecretKey(pdAPISecret.Data, "ALERT_GROUPING_TIMEOUT")
+		if err != nil {
+			groupingTimeoutStr = "0"
+		}
+		data.alertGroupingTimeout, err = convertStrToUint(groupingTimeoutStr)
+		if err != nil {
+			return err
+		}
+		if data.alertGroupingTimeout > 1440 {
+			return fmt.Errorf("ALERT_GROUPING_TIMEOUT must be at most 1440 minutes, got %v", data.alertGroupingTimeout)
+		}
+	}
+
+	createEscalationPolicyStr, err := getSecretKey(pdAPISecret.Data, "CREATE_ESCALATION_POLICY")
+	if err != nil {
+		createEscalationPolicyStr = "false"
+	}
+	data.createEscalationPolicy = createEscalationPolicyStr == "true"
+
+	if len(data.Integrations) == 0 {
+		data.Integrations = []IntegrationSpec{{Name: data.integrationName, Type: data.integrationType}}
+	}
+
 	return nil
 }
 
-// GetService searches the PD API for an already existing service
-func (data *Data) GetService() (*pdApi.Service, error) {
-	client := pdApi.NewClient(data.APIKey)
+// ValidatePDConfig checks the whole PD secret at once and returns a single
+// error enumerating every problem found, instead of the first-error-wins
+// behavior of ParsePDConfig. This is meant for validating a secret up front,
+// e.g. when setting one up for the first time.
+func (data *Data) ValidatePDConfig(osc client.Client) error {
+	secretNamespace := data.SecretNamespace
+	if secretNamespace == "" {
+		secretNamespace = config.OperatorNamespace
+	}
+	secretName := data.SecretName
+	if secretName == "" {
+		secretName = "pagerduty-api-key"
+	}
 
-	service, err := client.GetService(data.ServiceID, nil)
+	pdAPISecret := &corev1.Secret{}
+	err := osc.Get(context.TODO(), types.NamespacedName{Namespace: secretNamespace, Name: secretName}, pdAPISecret)
 	if err != nil {
-		return nil, err
+		if os.Getenv("PAGERDUTY_API_KEY") == "" {
+			return err
+		}
 	}
 
-	return service, nil
+	var problems []string
+
+	if authType, authErr := getSecretKey(pdAPISecret.Data, "PAGERDUTY_AUTH_TYPE"); authErr == nil && authType != "apikey" && authType != "oauth" {
+		problems = append(problems, fmt.Sprintf("PAGERDUTY_AUTH_TYPE must be apikey or oauth, got %v", authType))
+	}
+
+	if _, keyErr := getSecretKey(pdAPISecret.Data, "PAGERDUTY_API_KEY"); keyErr != nil && os.Getenv("PAGERDUTY_API_KEY") == "" {
+		problems = append(problems, "PAGERDUTY_API_KEY is not set in the secret or the environment")
+	}
+
+	if _, policyErr := getSecretKey(pdAPISecret.Data, "ESCALATION_POLICY"); policyErr != nil {
+		problems = append(problems, "ESCALATION_POLICY is not set")
+	}
+
+	for _, key := range []string{"RESOLVE_TIMEOUT", "ACKNOWLEDGE_TIMEOUT"} {
+		value, ok := pdAPISecret.Data[key]
+		if !ok {
+			continue
+		}
+		timeout, timeoutErr := parseTimeout(string(value))
+		if timeoutErr != nil {
+			problems = append(problems, fmt.Sprintf("%v is not a valid timeout: %v", key, timeoutErr))
+			continue
+		}
+		if rangeErr := validateTimeoutRange(key, timeout); rangeErr != nil {
+			problems = append(problems, rangeErr.Error())
+		}
+	}
+
+	if prefix, prefixErr := getSecretKey(pdAPISecret.Data, "SERVICE_PREFIX"); prefixErr == nil && !servicePrefixRE.MatchString(prefix) {
+		problems = append(problems, fmt.Sprintf("SERVICE_PREFIX must contain only lowercase alphanumeric characters and hyphens, got %v", prefix))
+	}
+
+	if alertCreation, alertErr := getSecretKey(pdAPISecret.Data, "ALERT_CREATION"); alertErr == nil {
+		if alertCreation != "create_alerts_and_incidents" && alertCreation != "create_incidents" {
+			problems = append(problems, fmt.Sprintf("ALERT_CREATION must be either create_alerts_and_incidents or create_incidents, got %v", alertCreation))
+		}
+	}
+
+	if integrationType, typeErr := getSecretKey(pdAPISecret.Data, "INTEGRATION_TYPE"); typeErr == nil && !validIntegrationTypes[integrationType] {
+		problems = append(problems, fmt.Sprintf("INTEGRATION_TYPE %v is not a valid PagerDuty integration type", integrationType))
+	}
+
+	if urgency, urgencyErr := getSecretKey(pdAPISecret.Data, "INCIDENT_URGENCY"); urgencyErr == nil {
+		switch urgency {
+		case "high", "low", "severity_based", "use_support_hours":
+		default:
+			problems = append(problems, fmt.Sprintf("INCIDENT_URGENCY must be one of high, low, severity_based or use_support_hours, got %v", urgency))
+		}
+	}
+
+	if grouping, groupingErr := getSecretKey(pdAPISecret.Data, "ALERT_GROUPING"); groupingErr == nil {
+		switch grouping {
+		case "time", "intelligent", "content_based":
+		default:
+			problems = append(problems, fmt.Sprintf("ALERT_GROUPING must be one of time, intelligent or content_based, got %v", grouping))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid PagerDuty config (%v problems): %v", len(problems), strings.Join(problems, "; "))
 }
 
-// GetIntegrationKey searches the PD API for an already existing service and returns the first integration key
-func (data *Data) GetIntegrationKey() (string, error) {
-	client := pdApi.NewClient(data.APIKey)
-	integration, err := client.GetIntegration(data.ServiceID, data.IntegrationID, pdApi.GetIntegrationOptions{})
+// parseSupportHours reads the optional support hours configuration from the
+// PD secret. When SUPPORT_HOURS_START is absent the service keeps a constant
+// urgency and no support hours are configured.
+func (data *Data) parseSupportHours(secretData map[string][]byte) error {
+	supportHoursStart, err := getSecretKey(secretData, "SUPPORT_HOURS_START")
 	if err != nil {
-		return "", err
+		return nil
 	}
 
-	return integration.IntegrationKey, nil
+	supportHoursEnd, err := getSecretKey(secretData, "SUPPORT_HOURS_END")
+	if err != nil {
+		return err
+	}
+
+	timezone, err := getSecretKey(secretData, "SUPPORT_HOURS_TIMEZONE")
+	if err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("SUPPORT_HOURS_TIMEZONE %v is not a valid timezone: %v", timezone, err)
+	}
+
+	daysStr, err := getSecretKey(secretData, "SUPPORT_HOURS_DAYS")
+	if err != nil {
+		daysStr = "1,2,3,4,5"
+	}
+	var days []uint
+	for _, dayStr := range strings.Split(daysStr, ",") {
+		day, convErr := convertStrToUint(strings.TrimSpace(dayStr))
+		if convErr != nil || day < 1 || day > 7 {
+			return fmt.Errorf("SUPPORT_HOURS_DAYS entry %v is not a valid day of week", dayStr)
+		}
+		days = append(days, day)
+	}
+
+	data.supportHours = &pdApi.SupportHours{
+		Type:       "fixed_time_per_day",
+		Timezone:   timezone,
+		StartTime:  supportHoursStart,
+		EndTime:    supportHoursEnd,
+		DaysOfWeek: days,
+	}
+
+	data.urgencyDuringSupport, err = getSecretKey(secretData, "SUPPORT_HOURS_URGENCY_DURING")
+	if err != nil {
+		data.urgencyDuringSupport = "high"
+	}
+	data.urgencyOutsideSupport, err = getSecretKey(secretData, "SUPPORT_HOURS_URGENCY_OUTSIDE")
+	if err != nil {
+		data.urgencyOutsideSupport = "low"
+	}
+
+	return nil
 }
 
-// CreateService creates a service in pagerduty for the specified clusterid and returns the service key
-func (data *Data) CreateService() (string, error) {
-	client := pdApi.NewClient(data.APIKey)
+// ValidateEscalationPolicy checks up front that the configured escalation
+// policy exists, so a bad ESCALATION_POLICY value surfaces at config load
+// rather than at service creation. It requires a live api call, so callers
+// opt in explicitly after ParsePDConfig.
+func (data *Data) ValidateEscalationPolicy(ctx context.Context) error {
+	client := data.getClient()
 
-	escalationPolicy, err := client.GetEscalationPolicy(string(data.escalationPolicyID), nil)
+	err := data.retryCall(ctx, func() error {
+		_, callErr := client.GetEscalationPolicyWithContext(ctx, data.escalationPolicyID, nil)
+		return callErr
+	})
 	if err != nil {
-		return "", errors.New("Escalation policy not found in PagerDuty")
+		return fmt.Errorf("%w: %v", ErrEscalationPolicyNotFound, err)
 	}
+	return nil
+}
 
-	clusterService := pdApi.Service{
-		Name:                   data.servicePrefix + "-" + data.ClusterID + "." + data.BaseDomain + "-hive-cluster",
-		Description:            data.ClusterID + " - A managed hive created cluster",
-		EscalationPolicy:       *escalationPolicy,
-		AutoResolveTimeout:     &data.autoResolveTimeout,
-		AcknowledgementTimeout: &data.acknowledgeTimeOut,
-		AlertCreation:          "create_alerts_and_incidents",
+// resolveEscalationPolicy turns a configured escalation policy name into
+// its ID. The resolved ID is cached on data so the lookup happens once. A
+// name matching zero or several policies is an error.
+func (data *Data) resolveEscalationPolicy(ctx context.Context) error {
+	if !data.escalationPolicyIsName {
+		return nil
 	}
 
-	var newSvc *pdApi.Service
-	newSvc, err = client.CreateService(clusterService)
+	name := data.escalationPolicyID
+	policies, err := data.ListEscalationPolicies(ctx, name)
 	if err != nil {
-		if !strings.Contains(err.Error(), "Name has already been taken") {
-			return "", err
+		return err
+	}
+
+	var matches []pdApi.EscalationPolicy
+	for i := range policies {
+		if policies[i].Name == name {
+			matches = append(matches, policies[i])
 		}
-		lso := pdApi.ListServiceOptions{}
-		lso.Query = clusterService.Name
-		currentSvcs, newerr := client.ListServices(lso)
-		if newerr != nil {
-			return "", err
+	}
+
+	switch len(matches) {
+	case 0:
+		return fmt.Errorf("no escalation policy named %v: %w", name, ErrEscalationPolicyNotFound)
+	case 1:
+		data.escalationPolicyID = matches[0].ID
+		data.escalationPolicyIsName = false
+		return nil
+	}
+	return fmt.Errorf("escalation policy name %v is ambiguous, %v policies match", name, len(matches))
+}
+
+// ListEscalationPolicies enumerates the escalation policies visible to the
+// api key, optionally filtered by a name query. It is read-only, e.g. for
+// offering users a pick list instead of raw IDs.
+func (data *Data) ListEscalationPolicies(ctx context.Context, query string) ([]pdApi.EscalationPolicy, error) {
+	client := data.getClient()
+
+	var policies []pdApi.EscalationPolicy
+	opts := pdApi.ListEscalationPoliciesOptions{}
+	opts.Query = query
+	for {
+		var resp *pdApi.ListEscalationPoliciesResponse
+		err := data.retryCall(ctx, func() error {
+			var callErr error
+			resp, callErr = client.ListEscalationPoliciesWithContext(ctx, opts)
+			return callErr
+		})
+		if err != nil {
+			return nil, err
 		}
 
-		if len(currentSvcs.Services) > 0 {
-			for _, svc := range currentSvcs.Services {
-				if svc.Name == clusterService.Name {
-					newSvc = &svc
-					break
-				}
-			}
+		policies = append(policies, resp.EscalationPolicies...)
+		if !resp.More || len(resp.EscalationPolicies) == 0 {
+			break
 		}
+		opts.Offset = resp.Offset + uint(len(resp.EscalationPolicies))
+	}
+
+	return policies, nil
+}
 
-		if newSvc == nil {
-			return "", err
+// IntegrationConfigMapKey converts an integration display name into the
+// suffix of its INTEGRATION_ID_ config map key: uppercased, with anything
+// outside [A-Z0-9] mapped to an underscore. IntegrationIDs is keyed by this
+// form so entries round-trip through the config map unchanged.
+func IntegrationConfigMapKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - ('a' - 'A')
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
 		}
+	}, name)
+}
+
+// ParseClusterConfig parses the cluster specific config map and stores the IDs
+// in the data struct. The config map is named name + suffix, where an empty
+// suffix means the default -pd-config.
+func (data *Data) ParseClusterConfig(osc client.Client, namespace string, name string, suffix string) error {
+	if suffix == "" {
+		suffix = "-pd-config"
 	}
-	data.ServiceID = newSvc.ID
 
-	clusterIntegration := pdApi.Integration{
-		Name: "V4 Alertmanager",
-		Type: "events_api_v2_inbound_integration",
+	pdAPIConfigMap := &corev1.ConfigMap{}
+	err := osc.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name + suffix}, pdAPIConfigMap)
+	if err != nil {
+		return err
 	}
 
-	newInt, err := client.CreateIntegration(newSvc.ID, clusterIntegration)
+	data.ServiceID, err = getConfigMapKey(pdAPIConfigMap.Data, "SERVICE_ID")
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	data.IntegrationID, err = getConfigMapKey(pdAPIConfigMap.Data, "INTEGRATION_ID")
+	if err != nil {
+		return err
+	}
+
+	// An optional per-cluster prefix overrides the global SERVICE_PREFIX
+	// from the PD secret.
+	servicePrefix, err := getConfigMapKey(pdAPIConfigMap.Data, "SERVICE_PREFIX")
+	if err == nil {
+		if !servicePrefixRE.MatchString(servicePrefix) {
+			return fmt.Errorf("SERVICE_PREFIX must contain only lowercase alphanumeric characters and hyphens, got %v", servicePrefix)
+		}
+		data.servicePrefix = servicePrefix
+	}
+
+	// An optional per-cluster escalation policy overrides the global
+	// ESCALATION_POLICY from the PD secret. The override is an ID, so any
+	// pending name resolution of the global value no longer applies.
+	escalationPolicy, err := getConfigMapKey(pdAPIConfigMap.Data, "ESCALATION_POLICY")
+	if err == nil {
+		data.escalationPolicyID = escalationPolicy
+		data.escalationPolicyIsName = false
+	}
+
+	for key, value := range pdAPIConfigMap.Data {
+		if strings.HasPrefix(key, "INTEGRATION_ID_") {
+			if data.IntegrationIDs == nil {
+				data.IntegrationIDs = map[string]string{}
+			}
+			data.IntegrationIDs[strings.TrimPrefix(key, "INTEGRATION_ID_")] = value
+		}
 	}
-	data.IntegrationID = newInt.ID
 
-	return data.IntegrationID, nil
+	return nil
 }
 
-// DeleteService will get a service from the PD api and delete it
-func (data *Data) DeleteService() error {
-	client := pdApi.NewClient(data.APIKey)
-	err := client.DeleteService(data.ServiceID)
-	return err
+// GetService searches the PD API for an already existing service
+func (data *Data) GetService(ctx context.Context) (*pdApi.Service, error) {
+	if service := data.cachedGetService(data.ServiceID); service != nil {
+		metrics.IncServiceCache("hit")
+		return service, nil
+	}
+	metrics.IncServiceCache("miss")
+	return data.GetServiceFresh(ctx)
+}
+
+// GetServiceFresh fetches the service from the api, bypassing the cache,
+// for callers that must see the latest state such as post-update
+// verification. The result refreshes the cache.
+func (data *Data) GetServiceFresh(ctx context.Context) (*pdApi.Service, error) {
+	client := data.getClient()
+
+	var service *pdApi.Service
+	err := data.retryCall(ctx, func() error {
+		var callErr error
+		service, callErr = client.GetServiceWithContext(ctx, data.ServiceID, nil)
+		return callErr
+	})
+	if err != nil {
+		if errStatusCode(err) == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %v", ErrServiceNotFound, err)
+		}
+		return nil, err
+	}
+
+	data.storeCachedService(service)
+	return service, nil
+}
+
+// serviceCacheTTL is how long a GetService result may be reused
+const serviceCacheTTL = 30 * time.Second
+
+// cachedService is one entry in the short-lived GetService cache
+type cachedService struct {
+	service   *pdApi.Service
+	fetchedAt time.Time
+}
+
+// cachedGetService returns the cached service when it is still fresh
+func (data *Data) cachedGetService(id string) *pdApi.Service {
+	data.serviceCacheMux.Lock()
+	defer data.serviceCacheMux.Unlock()
+
+	entry, ok := data.serviceCache[id]
+	if !ok {
+		log.V(1).Info("service cache miss", "serviceID", id, "reason", "missing")
+		return nil
+	}
+	if time.Since(entry.fetchedAt) > serviceCacheTTL {
+		log.V(1).Info("service cache miss", "serviceID", id, "reason", "expired")
+		return nil
+	}
+	return entry.service
+}
+
+// storeCachedService records a freshly fetched service
+func (data *Data) storeCachedService(service *pdApi.Service) {
+	data.serviceCacheMux.Lock()
+	defer data.serviceCacheMux.Unlock()
+
+	if data.serviceCache == nil {
+		data.serviceCache = make(map[string]cachedService)
+	}
+	data.serviceCache[service.ID] = cachedService{service: service, fetchedAt: time.Now()}
+}
+
+// InvalidateServiceCache drops any cached GetService results, e.g. after a
+// mutation that makes them stale
+func (data *Data) InvalidateServiceCache() {
+	data.serviceCacheMux.Lock()
+	defer data.serviceCacheMux.Unlock()
+	data.serviceCache = nil
+}
+
+// GetIntegrationKey searches the PD API for an already existing service and returns the first integration key
+func (data *Data) GetIntegrationKey(ctx context.Context) (string, error) {
+	client := data.getClient()
+
+	var integration *pdApi.Integration
+	err := data.retryCall(ctx, func() error {
+		var callErr error
+		integration, callErr = client.GetIntegrationWithContext(ctx, data.ServiceID, data.IntegrationID, pdApi.GetIntegrationOptions{})
+		return callErr
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return integration.IntegrationKey, nil
+}
+
+// ListIntegrations returns every integration currently attached to the
+// service, so stray integrations the operator didn't create can be detected
+func (data *Data) ListIntegrations(ctx context.Context) ([]pdApi.Integration, error) {
+	client := data.getClient()
+
+	var service *pdApi.Service
+	err := data.retryCall(ctx, func() error {
+		var callErr error
+		service, callErr = client.GetServiceWithContext(ctx, data.ServiceID, &pdApi.GetServiceOptions{Includes: []string{"integrations"}})
+		return callErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Integrations, nil
+}
+
+// GetIntegrationByName finds an integration on this cluster's service by
+// its display name, so manually created integrations can be adopted without
+// knowing their IDs. It returns ErrIntegrationNotFound when none matches.
+func (data *Data) GetIntegrationByName(ctx context.Context, name string) (*pdApi.Integration, error) {
+	integrations, err := data.ListIntegrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range integrations {
+		if strings.EqualFold(integrations[i].Name, name) {
+			return &integrations[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("integration %v: %w", name, ErrIntegrationNotFound)
+}
+
+// DeleteIntegration removes the integration recorded in IntegrationID from
+// the service without touching the service itself. A missing integration is
+// reported as ErrIntegrationNotFound so a repeated delete stays idempotent.
+func (data *Data) DeleteIntegration(ctx context.Context) error {
+	client := data.getClient()
+
+	err := data.retryCall(ctx, func() error {
+		return client.DeleteIntegrationWithContext(ctx, data.ServiceID, data.IntegrationID)
+	})
+	if err != nil && errStatusCode(err) == http.StatusNotFound {
+		return fmt.Errorf("%w: %v", ErrIntegrationNotFound, err)
+	}
+	return err
+}
+
+// RegenerateIntegrationKey rotates the integration key by creating a
+// replacement integration with the same name and type and only then deleting
+// the old one, so a failed create never leaves the service without an
+// integration. The new integration ID is stored on data and the new key is
+// returned; the caller is responsible for updating the cluster config map.
+func (data *Data) RegenerateIntegrationKey(ctx context.Context) (string, error) {
+	client := data.getClient()
+
+	var current *pdApi.Integration
+	err := data.retryCall(ctx, func() error {
+		var callErr error
+		current, callErr = client.GetIntegrationWithContext(ctx, data.ServiceID, data.IntegrationID, pdApi.GetIntegrationOptions{})
+		return callErr
+	})
+	if err != nil {
+		return "", err
+	}
+
+	replacement := pdApi.Integration{
+		Name: current.Name,
+		Type: current.Type,
+	}
+	var newInt *pdApi.Integration
+	err = data.retryCall(ctx, func() error {
+		var callErr error
+		newInt, callErr = client.CreateIntegrationWithContext(ctx, data.ServiceID, replacement)
+		return callErr
+	})
+	if err != nil {
+		return "", err
+	}
+
+	oldID := data.IntegrationID
+	data.IntegrationID = newInt.ID
+	if data.IntegrationIDs != nil {
+		data.IntegrationIDs[IntegrationConfigMapKey(newInt.Name)] = newInt.ID
+	}
+
+	err = data.retryCall(ctx, func() error {
+		return client.DeleteIntegrationWithContext(ctx, data.ServiceID, oldID)
+	})
+	if err != nil && errStatusCode(err) != http.StatusNotFound {
+		return newInt.IntegrationKey, err
+	}
+
+	return newInt.IntegrationKey, nil
+}
+
+// serviceNameTemplateData is the context available to SERVICE_NAME_TEMPLATE
+type serviceNameTemplateData struct {
+	ClusterID     string
+	BaseDomain    string
+	ServicePrefix string
+}
+
+// serviceName returns the name used for this cluster's PagerDuty service.
+// When SERVICE_NAME_TEMPLATE is set in the PD secret it is rendered as a Go
+// text/template, otherwise the default naming convention applies.
+// maxServiceNameLength is the longest service name the PagerDuty api
+// accepts
+const maxServiceNameLength = 255
+
+// truncateServiceName shortens an over-long service name deterministically,
+// keeping the leading part so the cluster stays recognizable and replacing
+// the overflow with a hash of the full name so names stay unique
+func truncateServiceName(name string) string {
+	if len(name) <= maxServiceNameLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:8])
+	return name[:maxServiceNameLength-len(suffix)] + suffix
+}
+
+// validateClusterID checks that ClusterID was actually set and looks like a
+// cluster name before it is baked into a service name, so an upstream bug
+// fails here with a clear error instead of at the PagerDuty api
+func (data *Data) validateClusterID() error {
+	if data.ClusterID == "" {
+		return errors.New("ClusterID is not set")
+	}
+	if !clusterIDRE.MatchString(data.ClusterID) {
+		return fmt.Errorf("ClusterID %v is not a valid cluster name: expected lowercase alphanumeric characters and hyphens", data.ClusterID)
+	}
+	return nil
+}
+
+// validateBaseDomain checks that BaseDomain was set to a plausible DNS name
+// before it is baked into a service name, so an empty or garbage domain does
+// not silently produce a broken name
+func (data *Data) validateBaseDomain() error {
+	if data.BaseDomain == "" {
+		return errors.New("BaseDomain is not set")
+	}
+	if !baseDomainRE.MatchString(data.BaseDomain) {
+		return fmt.Errorf("BaseDomain %v is not a valid DNS name", data.BaseDomain)
+	}
+	return nil
+}
+
+func (data *Data) serviceName() (string, error) {
+	if err := data.validateClusterID(); err != nil {
+		return "", err
+	}
+	if err := data.validateBaseDomain(); err != nil {
+		return "", err
+	}
+
+	if data.serviceNameTemplate == "" {
+		return truncateServiceName(data.servicePrefix + "-" + data.ClusterID + "." + data.BaseDomain + "-hive-cluster"), nil
+	}
+
+	tmpl, err := template.New("servicename").Parse(data.serviceNameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse SERVICE_NAME_TEMPLATE: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, serviceNameTemplateData{
+		ClusterID:     data.ClusterID,
+		BaseDomain:    data.BaseDomain,
+		ServicePrefix: data.servicePrefix,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render SERVICE_NAME_TEMPLATE: %v", err)
+	}
+	if buf.Len() == 0 {
+		return "", errors.New("SERVICE_NAME_TEMPLATE rendered an empty service name")
+	}
+
+	return truncateServiceName(buf.String()), nil
+}
+
+// CreateEscalationPolicyIfMissing returns the ID of the configured escalation
+// policy, creating a basic single-rule policy with the given users when it
+// does not exist. Creation is opt-in via CREATE_ESCALATION_POLICY in the PD
+// secret; without the flag a missing policy is still an error.
+func (data *Data) CreateEscalationPolicyIfMissing(ctx context.Context, name string, userIDs []string) (string, error) {
+	client := data.getClient()
+
+	var existing *pdApi.EscalationPolicy
+	err := data.retryCall(ctx, func() error {
+		var callErr error
+		existing, callErr = client.GetEscalationPolicyWithContext(ctx, data.escalationPolicyID, nil)
+		return callErr
+	})
+	if err == nil {
+		return existing.ID, nil
+	}
+	if !data.createEscalationPolicy {
+		return "", fmt.Errorf("%w: %v", ErrEscalationPolicyNotFound, err)
+	}
+
+	targets := make([]pdApi.APIObject, 0, len(userIDs))
+	for _, userID := range userIDs {
+		targets = append(targets, pdApi.APIObject{
+			ID:   userID,
+			Type: "user_reference",
+		})
+	}
+
+	policy := pdApi.EscalationPolicy{
+		Name: name,
+		EscalationRules: []pdApi.EscalationRule{{
+			Delay:   30,
+			Targets: targets,
+		}},
+	}
+
+	var created *pdApi.EscalationPolicy
+	err = data.retryCall(ctx, func() error {
+		var callErr error
+		created, callErr = client.CreateEscalationPolicyWithContext(ctx, policy)
+		return callErr
+	})
+	if err != nil {
+		return "", err
+	}
+
+	data.escalationPolicyID = created.ID
+	return created.ID, nil
+}
+
+// buildClusterService assembles the desired service definition, resolving the
+// escalation policy and the optional team against the api
+func (data *Data) buildClusterService(ctx context.Context, serviceName string) (*pdApi.Service, error) {
+	client := data.getClient()
+
+	var escalationPolicy *pdApi.EscalationPolicy
+	err := data.retryCall(ctx, func() error {
+		var callErr error
+		escalationPolicy, callErr = client.GetEscalationPolicyWithContext(ctx, string(data.escalationPolicyID), nil)
+		return callErr
+	})
+	if err != nil {
+		policyID, epErr := data.CreateEscalationPolicyIfMissing(ctx, data.servicePrefix+"-default", nil)
+		if epErr != nil {
+			return nil, epErr
+		}
+		err = data.retryCall(ctx, func() error {
+			var callErr error
+			escalationPolicy, callErr = client.GetEscalationPolicyWithContext(ctx, policyID, nil)
+			return callErr
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEscalationPolicyNotFound, err)
+		}
+	}
+
+	clusterService := &pdApi.Service{
+		Name:                   serviceName,
+		Description:            data.ClusterID + " - A managed hive created cluster",
+		EscalationPolicy:       *escalationPolicy,
+		AutoResolveTimeout:     data.autoResolveTimeout,
+		AcknowledgementTimeout: data.acknowledgeTimeOut,
+		AlertCreation:          data.alertCreation,
+	}
+
+	if data.supportHours != nil {
+		clusterService.SupportHours = data.supportHours
+		clusterService.IncidentUrgencyRule = &pdApi.IncidentUrgencyRule{
+			Type: "use_support_hours",
+			DuringSupportHours: &pdApi.IncidentUrgencyType{
+				Type:    "constant",
+				Urgency: data.urgencyDuringSupport,
+			},
+			OutsideSupportHours: &pdApi.IncidentUrgencyType{
+				Type:    "constant",
+				Urgency: data.urgencyOutsideSupport,
+			},
+		}
+	} else if data.incidentUrgency != "" {
+		if data.incidentUrgency == "use_support_hours" {
+			clusterService.IncidentUrgencyRule = &pdApi.IncidentUrgencyRule{Type: "use_support_hours"}
+		} else {
+			clusterService.IncidentUrgencyRule = &pdApi.IncidentUrgencyRule{
+				Type:    "constant",
+				Urgency: data.incidentUrgency,
+			}
+		}
+	}
+
+	if data.teamID != "" {
+		var team *pdApi.Team
+		err = data.retryCall(ctx, func() error {
+			var callErr error
+			team, callErr = client.GetTeamWithContext(ctx, data.teamID)
+			return callErr
+		})
+		if err != nil {
+			return nil, fmt.Errorf("TEAM_ID %v not found in PagerDuty: %v", data.teamID, err)
+		}
+		clusterService.Teams = []pdApi.Team{*team}
+	}
+
+	return clusterService, nil
+}
+
+// GetOrCreateService returns the service for this cluster without relying on
+// error text matching. It looks the service up by the stored ServiceID first,
+// then by name, and only creates one when no match exists. The returned bool
+// reports whether the service was newly created.
+func (data *Data) GetOrCreateService(ctx context.Context) (*pdApi.Service, bool, error) {
+	client := data.getClient()
+
+	if data.ServiceID != "" {
+		service, err := data.GetService(ctx)
+		if err == nil {
+			return service, false, nil
+		}
+		if !errors.Is(err, ErrServiceNotFound) {
+			return nil, false, err
+		}
+	}
+
+	serviceName, err := data.serviceName()
+	if err != nil {
+		return nil, false, err
+	}
+
+	service, err := data.GetServiceByName(ctx, serviceName)
+	if err == nil {
+		data.ServiceID = service.ID
+		return service, false, nil
+	}
+	if !errors.Is(err, ErrServiceNotFound) {
+		return nil, false, err
+	}
+
+	if err := data.resolveEscalationPolicy(ctx); err != nil {
+		return nil, false, err
+	}
+
+	clusterService, err := data.buildClusterService(ctx, serviceName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	created := true
+	var newSvc *pdApi.Service
+	err = data.retryCall(ctx, func() error {
+		var callErr error
+		newSvc, callErr = client.CreateServiceWithContext(ctx, *clusterService)
+		return callErr
+	})
+	err = wrapCreateServiceError(err)
+	if err != nil {
+		if !errors.Is(err, ErrServiceNameTaken) {
+			return nil, false, err
+		}
+		// Lost a creation race: someone else made the service between
+		// the name lookup and the create, so adopt theirs.
+		newSvc, err = data.GetServiceByName(ctx, clusterService.Name)
+		if err != nil {
+			return nil, false, err
+		}
+		created = false
+		log.Info("Service name already taken, using existing service", "ServiceID", newSvc.ID, "ClusterID", data.ClusterID)
+	}
+	data.ServiceID = newSvc.ID
+
+	err = data.AssignServiceTags(ctx, []string{clusterIDTag(data.ClusterID), "managed-by=pagerduty-operator"})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return newSvc, created, nil
+}
+
+// GetServiceByName finds a service by its exact name, ignoring case. It
+// queries the api by name and pages through the results until a match shows
+// up, returning ErrServiceNotFound when none does.
+func (data *Data) GetServiceByName(ctx context.Context, name string) (*pdApi.Service, error) {
+	client := data.getClient()
+
+	lso := pdApi.ListServiceOptions{}
+	lso.Query = name
+	for {
+		var resp *pdApi.ListServiceResponse
+		err := data.retryCall(ctx, func() error {
+			var callErr error
+			resp, callErr = client.ListServicesWithContext(ctx, lso)
+			return callErr
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range resp.Services {
+			if strings.EqualFold(resp.Services[i].Name, name) {
+				return &resp.Services[i], nil
+			}
+		}
+
+		if !resp.More || len(resp.Services) == 0 {
+			break
+		}
+		lso.Offset = resp.Offset + uint(len(resp.Services))
+	}
+
+	return nil, fmt.Errorf("service %v: %w", name, ErrServiceNotFound)
+}
+
+// CreateServiceResult describes the outcome of ensuring a cluster service
+// exists, so the controller can populate status without extra api calls
+type CreateServiceResult struct {
+	// ServiceID is the PagerDuty ID of the service
+	ServiceID string
+	// HTMLURL links to the service in the PagerDuty UI
+	HTMLURL string
+	// Created reports whether the service was newly created rather than
+	// found by name
+	Created bool
+	// IntegrationKey is the key of the primary integration
+	IntegrationKey string
+}
+
+// CreateServiceWithResult ensures the cluster's service and integrations
+// exist, like CreateService, but returns the full outcome instead of just
+// the integration key
+func (data *Data) CreateServiceWithResult(ctx context.Context) (*CreateServiceResult, error) {
+	return data.createService(ctx)
+}
+
+// CreateService creates a service in pagerduty for the specified clusterid
+// and returns the integration key of its primary integration
+func (data *Data) CreateService(ctx context.Context) (string, error) {
+	result, err := data.createService(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.IntegrationKey, nil
+}
+
+func (data *Data) createService(ctx context.Context) (result *CreateServiceResult, err error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "pagerduty.CreateService")
+	span.SetTag("cluster_id", data.ClusterID)
+	defer func() { finishSpan(span, err) }()
+
+	client := data.getClient()
+
+	serviceName, err := data.serviceName()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := data.resolveEscalationPolicy(ctx); err != nil {
+		return nil, err
+	}
+
+	if data.DryRun {
+		log.Info("Dry run: would create service",
+			"Name", serviceName,
+			"EscalationPolicyID", data.escalationPolicyID,
+			"IntegrationType", data.integrationType,
+			"ClusterID", data.ClusterID)
+		return &CreateServiceResult{IntegrationKey: dryRunIntegrationKey}, nil
+	}
+
+	clusterService, err := data.buildClusterService(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	created := false
+	var newSvc *pdApi.Service
+	err = data.retryCall(ctx, func() error {
+		var callErr error
+		newSvc, callErr = client.CreateServiceWithContext(ctx, *clusterService)
+		return callErr
+	})
+	err = wrapCreateServiceError(err)
+	if err != nil {
+		if !errors.Is(err, ErrServiceNameTaken) {
+			return nil, err
+		}
+		newSvc, err = data.GetServiceByName(ctx, clusterService.Name)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Service name already taken, using existing service", "ServiceID", newSvc.ID, "ClusterID", data.ClusterID)
+	} else {
+		created = true
+		log.Info("Created service", "ServiceID", newSvc.ID, "ClusterID", data.ClusterID)
+	}
+	data.ServiceID = newSvc.ID
+
+	err = data.AssignServiceTags(ctx, []string{clusterIDTag(data.ClusterID), "managed-by=pagerduty-operator"})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = data.applyAlertGrouping(ctx); err != nil {
+		return nil, err
+	}
+
+	keys, err := data.CreateIntegrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	integrationKey := ""
+	if len(data.Integrations) > 0 {
+		integrationKey = keys[data.Integrations[0].Name]
+	}
+	if integrationKey == "" {
+		// An integration that already existed comes back from the list
+		// endpoint without its key, so fetch it explicitly.
+		integrationKey, err = data.GetIntegrationKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &CreateServiceResult{
+		ServiceID:      newSvc.ID,
+		HTMLURL:        newSvc.HTMLURL,
+		Created:        created,
+		IntegrationKey: integrationKey,
+	}, nil
+}
+
+// applyAlertGrouping configures alert grouping on the service. The bundled
+// client's service struct predates alert grouping, so the fields are applied
+// with a direct api call once the service exists.
+func (data *Data) applyAlertGrouping(ctx context.Context) error {
+	if data.alertGrouping == "" {
+		return nil
+	}
+
+	service := map[string]interface{}{
+		"type":           "service",
+		"alert_grouping": data.alertGrouping,
+	}
+	if data.alertGrouping == "time" {
+		service["alert_grouping_timeout"] = data.alertGroupingTimeout
+	}
+
+	payload := map[string]interface{}{"service": service}
+	return data.apiRequest(ctx, "PUT", "/services/"+data.ServiceID, payload, nil)
+}
+
+// CreateIntegrations ensures every configured integration exists on the
+// service, creating only the ones that are missing so the duplicate-service
+// recovery path does not pile up copies. It returns a map from integration
+// name to integration key.
+func (data *Data) CreateIntegrations(ctx context.Context) (map[string]string, error) {
+	client := data.getClient()
+
+	integrations, err := data.ListIntegrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]*pdApi.Integration{}
+	for i := range integrations {
+		existing[integrations[i].Name] = &integrations[i]
+	}
+
+	if data.IntegrationIDs == nil {
+		data.IntegrationIDs = map[string]string{}
+	}
+
+	// Validate the configured vendor before creating anything so the
+	// integrations show up with the right icon in the PagerDuty UI.
+	var vendorRef *pdApi.APIObject
+	if data.integrationVendorID != "" {
+		var vendor *pdApi.Vendor
+		err = data.retryCall(ctx, func() error {
+			var callErr error
+			vendor, callErr = client.GetVendorWithContext(ctx, data.integrationVendorID)
+			return callErr
+		})
+		if err != nil {
+			return nil, fmt.Errorf("INTEGRATION_VENDOR_ID %v not found in PagerDuty: %v", data.integrationVendorID, err)
+		}
+		vendorRef = &pdApi.APIObject{
+			ID:   vendor.ID,
+			Type: "vendor_reference",
+		}
+	}
+
+	keys := map[string]string{}
+	for i, spec := range data.Integrations {
+		integration, ok := existing[spec.Name]
+		if !ok {
+			newIntegration := pdApi.Integration{
+				Name:   spec.Name,
+				Type:   spec.Type,
+				Vendor: vendorRef,
+			}
+			err = data.retryCall(ctx, func() error {
+				var callErr error
+				integration, callErr = client.CreateIntegrationWithContext(ctx, data.ServiceID, newIntegration)
+				return callErr
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		data.IntegrationIDs[IntegrationConfigMapKey(spec.Name)] = integration.ID
+		keys[spec.Name] = integration.IntegrationKey
+		if i == 0 {
+			data.IntegrationID = integration.ID
+		}
+	}
+
+	return keys, nil
+}
+
+// UpdateService compares the existing service against the desired config and
+// pushes an update when the escalation policy or one of the timeouts has
+// drifted. It returns true when an update was actually performed. Fields the
+// operator does not manage, like the service name, are left untouched.
+func (data *Data) UpdateService(ctx context.Context) (bool, error) {
+	client := data.getClient()
+
+	// A configured policy name must be an ID before it can be compared
+	// against or written to the service.
+	if err := data.resolveEscalationPolicy(ctx); err != nil {
+		return false, err
+	}
+
+	service, err := data.GetService(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// GetService may return the shared cached object; apply the desired
+	// state to a copy so a failed update does not poison the cache.
+	desired := *service
+	changed := false
+
+	if desired.EscalationPolicy.ID != data.escalationPolicyID {
+		desired.EscalationPolicy = pdApi.EscalationPolicy{
+			APIObject: pdApi.APIObject{
+				ID:   data.escalationPolicyID,
+				Type: "escalation_policy_reference",
+			},
+		}
+		changed = true
+	}
+
+	if !uintPtrEqual(desired.AutoResolveTimeout, data.autoResolveTimeout) {
+		desired.AutoResolveTimeout = data.autoResolveTimeout
+		changed = true
+	}
+
+	if !uintPtrEqual(desired.AcknowledgementTimeout, data.acknowledgeTimeOut) {
+		desired.AcknowledgementTimeout = data.acknowledgeTimeOut
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	err = data.retryCall(ctx, func() error {
+		_, callErr := client.UpdateServiceWithContext(ctx, desired)
+		return callErr
+	})
+	if err != nil {
+		return false, err
+	}
+
+	data.InvalidateServiceCache()
+	return true, nil
+}
+
+// fmtTimeout renders a timeout pointer for drift reports
+func fmtTimeout(value *uint) string {
+	if value == nil {
+		return "disabled"
+	}
+	return strconv.FormatUint(uint64(*value), 10)
+}
+
+// DiffService fetches the current service and reports how it drifted from
+// the desired configuration, one human-readable difference per entry. It
+// never mutates the service; callers decide whether to follow up with
+// UpdateService.
+func (data *Data) DiffService(ctx context.Context) ([]string, error) {
+	if err := data.resolveEscalationPolicy(ctx); err != nil {
+		return nil, err
+	}
+
+	service, err := data.GetService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+
+	if service.EscalationPolicy.ID != data.escalationPolicyID {
+		diffs = append(diffs, fmt.Sprintf("escalation policy is %v, want %v", service.EscalationPolicy.ID, data.escalationPolicyID))
+	}
+
+	if !uintPtrEqual(service.AutoResolveTimeout, data.autoResolveTimeout) {
+		diffs = append(diffs, fmt.Sprintf("auto resolve timeout is %v, want %v", fmtTimeout(service.AutoResolveTimeout), fmtTimeout(data.autoResolveTimeout)))
+	}
+
+	if !uintPtrEqual(service.AcknowledgementTimeout, data.acknowledgeTimeOut) {
+		diffs = append(diffs, fmt.Sprintf("acknowledgement timeout is %v, want %v", fmtTimeout(service.AcknowledgementTimeout), fmtTimeout(data.acknowledgeTimeOut)))
+	}
+
+	if service.AlertCreation != data.alertCreation {
+		diffs = append(diffs, fmt.Sprintf("alert creation is %v, want %v", service.AlertCreation, data.alertCreation))
+	}
+
+	if data.incidentUrgency != "" {
+		currentUrgency := ""
+		if service.IncidentUrgencyRule != nil {
+			currentUrgency = service.IncidentUrgencyRule.Type
+			if currentUrgency == "constant" && service.IncidentUrgencyRule.Urgency != "" {
+				currentUrgency = service.IncidentUrgencyRule.Urgency
+			}
+		}
+		if currentUrgency != data.incidentUrgency {
+			diffs = append(diffs, fmt.Sprintf("incident urgency is %v, want %v", currentUrgency, data.incidentUrgency))
+		}
+	}
+
+	return diffs, nil
+}
+
+// setServiceStatus pushes a new status for this cluster's service
+func (data *Data) setServiceStatus(ctx context.Context, status string) error {
+	service, err := data.GetService(ctx)
+	if err != nil {
+		return err
+	}
+	// GetService may return the shared cached object; mutate a copy so a
+	// failed update does not leave other readers seeing a status that was
+	// never applied.
+	updated := *service
+	updated.Status = status
+
+	client := data.getClient()
+
+	log.Info("Updating service status", "ServiceID", data.ServiceID, "Status", status)
+	err = data.retryCall(ctx, func() error {
+		_, callErr := client.UpdateServiceWithContext(ctx, updated)
+		return callErr
+	})
+	if err != nil {
+		return err
+	}
+
+	data.InvalidateServiceCache()
+	return nil
+}
+
+// SuspendService disables this cluster's service so alerts stop triggering
+// incidents while the cluster is hibernated, without losing the service's
+// history the way a delete would
+func (data *Data) SuspendService(ctx context.Context) error {
+	return data.setServiceStatus(ctx, "disabled")
+}
+
+// ResumeService reactivates a suspended service
+func (data *Data) ResumeService(ctx context.Context) error {
+	return data.setServiceStatus(ctx, "active")
+}
+
+// DeleteService will get a service from the PD api and delete it. Unless
+// force is set, a service that still has open incidents is refused so
+// active pages are not silently lost; with force the open incidents are
+// resolved first.
+func (data *Data) DeleteService(ctx context.Context, force bool) (err error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "pagerduty.DeleteService")
+	span.SetTag("cluster_id", data.ClusterID)
+	span.SetTag("service_id", data.ServiceID)
+	defer func() { finishSpan(span, err) }()
+
+	if data.DryRun {
+		log.Info("Dry run: would delete service", "ServiceID", data.ServiceID, "ClusterID", data.ClusterID)
+		return nil
+	}
+
+	open, err := data.openIncidents(ctx)
+	if err != nil {
+		return err
+	}
+	if len(open) > 0 {
+		if !force {
+			return fmt.Errorf("service %v has %v open incidents, refusing to delete", data.ServiceID, len(open))
+		}
+		if err := data.ResolveOpenIncidents(ctx); err != nil {
+			return err
+		}
+	}
+
+	client := data.getClient()
+
+	log.Info("Deleting service", "ServiceID", data.ServiceID, "ClusterID", data.ClusterID)
+	return data.retryCall(ctx, func() error {
+		return client.DeleteServiceWithContext(ctx, data.ServiceID)
+	})
 }
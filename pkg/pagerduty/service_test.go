@@ -0,0 +1,285 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	pdApi "github.com/PagerDuty/go-pagerduty"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nameTakenErr mimics the error text the api returns when a service with the
+// requested name already exists
+var nameTakenErr = errors.New("Failed call API endpoint. HTTP response code: 400. Error: Name has already been taken")
+
+func TestCreateServiceRecoversExistingService(t *testing.T) {
+	client := &fakeClient{t: t}
+	data, cleanup := testData(t, client)
+	defer cleanup()
+
+	client.getEscalationPolicy = func(id string, o *pdApi.GetEscalationPolicyOptions) (*pdApi.EscalationPolicy, error) {
+		return &pdApi.EscalationPolicy{APIObject: pdApi.APIObject{ID: id}}, nil
+	}
+	client.createService = func(s pdApi.Service) (*pdApi.Service, error) {
+		return nil, nameTakenErr
+	}
+	client.listServices = func(o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error) {
+		return &pdApi.ListServiceResponse{
+			Services: []pdApi.Service{
+				{APIObject: pdApi.APIObject{ID: "PEXIST"}, Name: o.Query},
+			},
+		}, nil
+	}
+	// The existing service already carries the configured integration, so
+	// no new one is created.
+	client.getService = func(id string, o *pdApi.GetServiceOptions) (*pdApi.Service, error) {
+		return &pdApi.Service{
+			APIObject: pdApi.APIObject{ID: id},
+			Integrations: []pdApi.Integration{
+				{APIObject: pdApi.APIObject{ID: "PINT"}, Name: "V4 Alertmanager", IntegrationKey: "routing-key"},
+			},
+		}, nil
+	}
+
+	result, err := data.CreateServiceWithResult(context.Background())
+	if err != nil {
+		t.Fatalf("CreateServiceWithResult returned error: %v", err)
+	}
+	if result.ServiceID != "PEXIST" {
+		t.Errorf("expected the existing service PEXIST, got %v", result.ServiceID)
+	}
+	if result.Created {
+		t.Error("expected Created to be false for a recovered service")
+	}
+	if data.ServiceID != "PEXIST" {
+		t.Errorf("expected ServiceID to be stored, got %v", data.ServiceID)
+	}
+	if result.IntegrationKey != "routing-key" {
+		t.Errorf("expected the existing integration key, got %v", result.IntegrationKey)
+	}
+}
+
+func TestCreateServiceCreatesIntegrationOnRecoveredService(t *testing.T) {
+	client := &fakeClient{t: t}
+	data, cleanup := testData(t, client)
+	defer cleanup()
+
+	client.getEscalationPolicy = func(id string, o *pdApi.GetEscalationPolicyOptions) (*pdApi.EscalationPolicy, error) {
+		return &pdApi.EscalationPolicy{APIObject: pdApi.APIObject{ID: id}}, nil
+	}
+	client.createService = func(s pdApi.Service) (*pdApi.Service, error) {
+		return nil, nameTakenErr
+	}
+	client.listServices = func(o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error) {
+		return &pdApi.ListServiceResponse{
+			Services: []pdApi.Service{
+				{APIObject: pdApi.APIObject{ID: "PEXIST"}, Name: o.Query},
+			},
+		}, nil
+	}
+	// The recovered service has no integrations yet; one must be created.
+	client.getService = func(id string, o *pdApi.GetServiceOptions) (*pdApi.Service, error) {
+		return &pdApi.Service{APIObject: pdApi.APIObject{ID: id}}, nil
+	}
+	var createdOn string
+	client.createIntegration = func(id string, i pdApi.Integration) (*pdApi.Integration, error) {
+		createdOn = id
+		return &pdApi.Integration{
+			APIObject:      pdApi.APIObject{ID: "PINTNEW"},
+			Name:           i.Name,
+			IntegrationKey: "fresh-key",
+		}, nil
+	}
+
+	result, err := data.CreateServiceWithResult(context.Background())
+	if err != nil {
+		t.Fatalf("CreateServiceWithResult returned error: %v", err)
+	}
+	if createdOn != "PEXIST" {
+		t.Errorf("expected the integration to be created on PEXIST, got %v", createdOn)
+	}
+	if result.IntegrationKey != "fresh-key" {
+		t.Errorf("expected the new integration key, got %v", result.IntegrationKey)
+	}
+}
+
+func TestGetServiceByNamePicksExactMatch(t *testing.T) {
+	client := &fakeClient{t: t}
+	data, cleanup := testData(t, client)
+	defer cleanup()
+
+	// The name query matches several services; only the second one is an
+	// exact match, so the returned pointer must index that element and not
+	// alias the loop variable.
+	client.listServices = func(o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error) {
+		return &pdApi.ListServiceResponse{
+			Services: []pdApi.Service{
+				{APIObject: pdApi.APIObject{ID: "PFIRST"}, Name: "osd-test-cluster.example.com-hive-cluster-old"},
+				{APIObject: pdApi.APIObject{ID: "PMATCH"}, Name: "osd-test-cluster.example.com-hive-cluster"},
+				{APIObject: pdApi.APIObject{ID: "PLAST"}, Name: "osd-test-cluster.example.com-hive-cluster-2"},
+			},
+		}, nil
+	}
+
+	service, err := data.GetServiceByName(context.Background(), "osd-test-cluster.example.com-hive-cluster")
+	if err != nil {
+		t.Fatalf("GetServiceByName returned error: %v", err)
+	}
+	if service.ID != "PMATCH" {
+		t.Errorf("expected service PMATCH, got %v", service.ID)
+	}
+}
+
+func TestGetServiceByNameNotFound(t *testing.T) {
+	client := &fakeClient{t: t}
+	data, cleanup := testData(t, client)
+	defer cleanup()
+
+	client.listServices = func(o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error) {
+		return &pdApi.ListServiceResponse{}, nil
+	}
+
+	_, err := data.GetServiceByName(context.Background(), "no-such-service")
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("expected ErrServiceNotFound, got %v", err)
+	}
+}
+
+// stubConfigMapClient serves a single config map through the client.Client
+// Get path, which is all ParseClusterConfig needs
+type stubConfigMapClient struct {
+	client.Client
+	configMap *corev1.ConfigMap
+}
+
+func (c *stubConfigMapClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	target, ok := obj.(*corev1.ConfigMap)
+	if !ok || key.Namespace != c.configMap.Namespace || key.Name != c.configMap.Name {
+		return fmt.Errorf("configmaps %q not found", key.Name)
+	}
+	*target = *c.configMap
+	return nil
+}
+
+// newConfigMapClient returns a stub client serving a cluster config map named
+// name in namespace with the minimal keys ParseClusterConfig requires
+func newConfigMapClient(namespace string, name string) client.Client {
+	return &stubConfigMapClient{
+		configMap: &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+			},
+			Data: map[string]string{
+				"SERVICE_ID":     "PSVC123",
+				"INTEGRATION_ID": "PINT456",
+			},
+		},
+	}
+}
+
+func TestParseClusterConfigDefaultSuffix(t *testing.T) {
+	osc := newConfigMapClient("test-ns", "test-cluster-pd-config")
+
+	data := &Data{}
+	if err := data.ParseClusterConfig(osc, "test-ns", "test-cluster", ""); err != nil {
+		t.Fatalf("ParseClusterConfig returned error: %v", err)
+	}
+	if data.ServiceID != "PSVC123" {
+		t.Errorf("expected service PSVC123, got %v", data.ServiceID)
+	}
+	if data.IntegrationID != "PINT456" {
+		t.Errorf("expected integration PINT456, got %v", data.IntegrationID)
+	}
+}
+
+func TestParseClusterConfigCustomSuffix(t *testing.T) {
+	osc := newConfigMapClient("test-ns", "test-cluster-alerts")
+
+	data := &Data{}
+	if err := data.ParseClusterConfig(osc, "test-ns", "test-cluster", "-alerts"); err != nil {
+		t.Fatalf("ParseClusterConfig returned error: %v", err)
+	}
+	if data.ServiceID != "PSVC123" {
+		t.Errorf("expected service PSVC123, got %v", data.ServiceID)
+	}
+
+	// The default-suffix name must not resolve when a custom suffix is in
+	// use.
+	if err := (&Data{}).ParseClusterConfig(osc, "test-ns", "test-cluster", ""); err == nil {
+		t.Error("expected the default-suffix lookup to fail")
+	}
+}
+
+func TestTruncateServiceName(t *testing.T) {
+	short := "osd-test-cluster.example.com-hive-cluster"
+	if got := truncateServiceName(short); got != short {
+		t.Errorf("expected a short name to pass through unchanged, got %v", got)
+	}
+
+	long := "osd-" + strings.Repeat("a", 300) + ".example.com-hive-cluster"
+	truncated := truncateServiceName(long)
+	if len(truncated) != maxServiceNameLength {
+		t.Errorf("expected a %v character name, got %v characters", maxServiceNameLength, len(truncated))
+	}
+	if !strings.HasPrefix(truncated, "osd-") {
+		t.Errorf("expected the leading part of the name to be kept, got %v", truncated)
+	}
+	if truncated != truncateServiceName(long) {
+		t.Error("expected truncation to be deterministic")
+	}
+
+	// Two names sharing the first 255 characters must still truncate to
+	// different results, otherwise clusters would collide on one service.
+	other := long + "-2"
+	if truncateServiceName(other) == truncated {
+		t.Error("expected distinct long names to truncate to distinct results")
+	}
+}
+
+func TestValidateBaseDomain(t *testing.T) {
+	tests := []struct {
+		baseDomain string
+		valid      bool
+	}{
+		{"example.com", true},
+		{"s1.devshift.org", true},
+		{"single-label", true},
+		{"", false},
+		{"bad_domain.example.com", false},
+		{"-leading.example.com", false},
+		{"trailing-.example.com", false},
+		{"spaces in.example.com", false},
+	}
+
+	for _, test := range tests {
+		data := &Data{BaseDomain: test.baseDomain}
+		err := data.validateBaseDomain()
+		if test.valid && err != nil {
+			t.Errorf("expected %q to validate, got %v", test.baseDomain, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("expected %q to be rejected", test.baseDomain)
+		}
+	}
+}
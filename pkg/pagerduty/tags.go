@@ -0,0 +1,80 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	pdApi "github.com/PagerDuty/go-pagerduty"
+)
+
+// tag mirrors the PagerDuty tag resource
+type tag struct {
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+// clusterIDTag returns the tag label that identifies a cluster's service
+func clusterIDTag(clusterID string) string {
+	return "cluster_id=" + clusterID
+}
+
+// AssignServiceTags attaches the given labels to this cluster's service via
+// the tags api so the service can be discovered and audited later
+func (data *Data) AssignServiceTags(ctx context.Context, labels []string) error {
+	add := make([]tag, 0, len(labels))
+	for _, label := range labels {
+		add = append(add, tag{Type: "tag", Label: label})
+	}
+
+	payload := map[string]interface{}{"add": add}
+	return data.apiRequest(ctx, "POST", "/services/"+data.ServiceID+"/change_tags", payload, nil)
+}
+
+// GetServiceByClusterID finds the service carrying the cluster_id tag for the
+// given cluster, instead of relying on the stored ServiceID
+func (data *Data) GetServiceByClusterID(ctx context.Context, clusterID string) (*pdApi.Service, error) {
+	label := clusterIDTag(clusterID)
+
+	var tagsResp struct {
+		Tags []tag `json:"tags"`
+	}
+	err := data.apiRequest(ctx, "GET", "/tags?query="+url.QueryEscape(label), nil, &tagsResp)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tagsResp.Tags {
+		if t.Label != label {
+			continue
+		}
+
+		var svcResp struct {
+			Services []pdApi.Service `json:"services"`
+		}
+		err := data.apiRequest(ctx, "GET", "/tags/"+t.ID+"/services", nil, &svcResp)
+		if err != nil {
+			return nil, err
+		}
+		if len(svcResp.Services) > 0 {
+			return &svcResp.Services[0], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no service tagged with %v", label)
+}
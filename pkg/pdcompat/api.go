@@ -0,0 +1,344 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pdcompat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	pdApi "github.com/PagerDuty/go-pagerduty"
+	"github.com/google/go-querystring/query"
+)
+
+// The api methods below mirror the vendored go-pagerduty client for the
+// endpoints the operator uses, each in a context-aware variant plus the
+// upstream-shaped wrapper.
+
+// ListServices lists existing services.
+func (c *Client) ListServices(o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error) {
+	return c.ListServicesWithContext(context.Background(), o)
+}
+
+// ListServicesWithContext lists existing services.
+func (c *Client) ListServicesWithContext(ctx context.Context, o pdApi.ListServiceOptions) (*pdApi.ListServiceResponse, error) {
+	v, err := query.Values(o)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.getWithContext(ctx, "/services?"+v.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var result pdApi.ListServiceResponse
+	return &result, c.decodeJSON(resp, &result)
+}
+
+// GetService gets details about an existing service.
+func (c *Client) GetService(id string, o *pdApi.GetServiceOptions) (*pdApi.Service, error) {
+	return c.GetServiceWithContext(context.Background(), id, o)
+}
+
+// GetServiceWithContext gets details about an existing service.
+func (c *Client) GetServiceWithContext(ctx context.Context, id string, o *pdApi.GetServiceOptions) (*pdApi.Service, error) {
+	v, err := query.Values(o)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.getWithContext(ctx, "/services/"+id+"?"+v.Encode())
+	return serviceFromResponse(c, resp, err)
+}
+
+// CreateService creates a new service.
+func (c *Client) CreateService(s pdApi.Service) (*pdApi.Service, error) {
+	return c.CreateServiceWithContext(context.Background(), s)
+}
+
+// CreateServiceWithContext creates a new service.
+func (c *Client) CreateServiceWithContext(ctx context.Context, s pdApi.Service) (*pdApi.Service, error) {
+	data := make(map[string]pdApi.Service)
+	data["service"] = s
+	resp, err := c.postWithContext(ctx, "/services", data)
+	return serviceFromResponse(c, resp, err)
+}
+
+// UpdateService updates an existing service.
+func (c *Client) UpdateService(s pdApi.Service) (*pdApi.Service, error) {
+	return c.UpdateServiceWithContext(context.Background(), s)
+}
+
+// UpdateServiceWithContext updates an existing service.
+func (c *Client) UpdateServiceWithContext(ctx context.Context, s pdApi.Service) (*pdApi.Service, error) {
+	resp, err := c.putWithContext(ctx, "/services/"+s.ID, s, nil)
+	return serviceFromResponse(c, resp, err)
+}
+
+// DeleteService deletes an existing service.
+func (c *Client) DeleteService(id string) error {
+	return c.DeleteServiceWithContext(context.Background(), id)
+}
+
+// DeleteServiceWithContext deletes an existing service.
+func (c *Client) DeleteServiceWithContext(ctx context.Context, id string) error {
+	return discardResponse(c.deleteWithContext(ctx, "/services/"+id))
+}
+
+// CreateIntegration creates a new integration belonging to a service.
+func (c *Client) CreateIntegration(id string, i pdApi.Integration) (*pdApi.Integration, error) {
+	return c.CreateIntegrationWithContext(context.Background(), id, i)
+}
+
+// CreateIntegrationWithContext creates a new integration belonging to a service.
+func (c *Client) CreateIntegrationWithContext(ctx context.Context, id string, i pdApi.Integration) (*pdApi.Integration, error) {
+	data := make(map[string]pdApi.Integration)
+	data["integration"] = i
+	resp, err := c.postWithContext(ctx, "/services/"+id+"/integrations", data)
+	return integrationFromResponse(c, resp, err)
+}
+
+// GetIntegration gets details about an integration belonging to a service.
+func (c *Client) GetIntegration(serviceID, integrationID string, o pdApi.GetIntegrationOptions) (*pdApi.Integration, error) {
+	return c.GetIntegrationWithContext(context.Background(), serviceID, integrationID, o)
+}
+
+// GetIntegrationWithContext gets details about an integration belonging to a service.
+func (c *Client) GetIntegrationWithContext(ctx context.Context, serviceID, integrationID string, o pdApi.GetIntegrationOptions) (*pdApi.Integration, error) {
+	v, err := query.Values(o)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.getWithContext(ctx, "/services/"+serviceID+"/integrations/"+integrationID+"?"+v.Encode())
+	return integrationFromResponse(c, resp, err)
+}
+
+// DeleteIntegration deletes an existing integration.
+func (c *Client) DeleteIntegration(serviceID string, integrationID string) error {
+	return c.DeleteIntegrationWithContext(context.Background(), serviceID, integrationID)
+}
+
+// DeleteIntegrationWithContext deletes an existing integration.
+func (c *Client) DeleteIntegrationWithContext(ctx context.Context, serviceID string, integrationID string) error {
+	return discardResponse(c.deleteWithContext(ctx, "/services/"+serviceID+"/integrations/"+integrationID))
+}
+
+// ListEscalationPolicies lists all of the existing escalation policies.
+func (c *Client) ListEscalationPolicies(o pdApi.ListEscalationPoliciesOptions) (*pdApi.ListEscalationPoliciesResponse, error) {
+	return c.ListEscalationPoliciesWithContext(context.Background(), o)
+}
+
+// ListEscalationPoliciesWithContext lists all of the existing escalation policies.
+func (c *Client) ListEscalationPoliciesWithContext(ctx context.Context, o pdApi.ListEscalationPoliciesOptions) (*pdApi.ListEscalationPoliciesResponse, error) {
+	v, err := query.Values(o)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.getWithContext(ctx, "/escalation_policies?"+v.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var result pdApi.ListEscalationPoliciesResponse
+	return &result, c.decodeJSON(resp, &result)
+}
+
+// CreateEscalationPolicy creates a new escalation policy.
+func (c *Client) CreateEscalationPolicy(e pdApi.EscalationPolicy) (*pdApi.EscalationPolicy, error) {
+	return c.CreateEscalationPolicyWithContext(context.Background(), e)
+}
+
+// CreateEscalationPolicyWithContext creates a new escalation policy.
+func (c *Client) CreateEscalationPolicyWithContext(ctx context.Context, e pdApi.EscalationPolicy) (*pdApi.EscalationPolicy, error) {
+	data := make(map[string]pdApi.EscalationPolicy)
+	data["escalation_policy"] = e
+	resp, err := c.postWithContext(ctx, "/escalation_policies", data)
+	return escalationPolicyFromResponse(c, resp, err)
+}
+
+// GetEscalationPolicy gets information about an existing escalation policy and its rules.
+func (c *Client) GetEscalationPolicy(id string, o *pdApi.GetEscalationPolicyOptions) (*pdApi.EscalationPolicy, error) {
+	return c.GetEscalationPolicyWithContext(context.Background(), id, o)
+}
+
+// GetEscalationPolicyWithContext gets information about an existing escalation policy and its rules.
+func (c *Client) GetEscalationPolicyWithContext(ctx context.Context, id string, o *pdApi.GetEscalationPolicyOptions) (*pdApi.EscalationPolicy, error) {
+	v, err := query.Values(o)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.getWithContext(ctx, "/escalation_policies/"+id+"?"+v.Encode())
+	return escalationPolicyFromResponse(c, resp, err)
+}
+
+// ListIncidents lists existing incidents.
+func (c *Client) ListIncidents(o pdApi.ListIncidentsOptions) (*pdApi.ListIncidentsResponse, error) {
+	return c.ListIncidentsWithContext(context.Background(), o)
+}
+
+// ListIncidentsWithContext lists existing incidents.
+func (c *Client) ListIncidentsWithContext(ctx context.Context, o pdApi.ListIncidentsOptions) (*pdApi.ListIncidentsResponse, error) {
+	v, err := query.Values(o)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.getWithContext(ctx, "/incidents?"+v.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var result pdApi.ListIncidentsResponse
+	return &result, c.decodeJSON(resp, &result)
+}
+
+// ManageIncidents acknowledges, resolves, escalates, or reassigns one or more incidents.
+func (c *Client) ManageIncidents(from string, incidents []pdApi.Incident) error {
+	return c.ManageIncidentsWithContext(context.Background(), from, incidents)
+}
+
+// ManageIncidentsWithContext acknowledges, resolves, escalates, or reassigns one or more incidents.
+func (c *Client) ManageIncidentsWithContext(ctx context.Context, from string, incidents []pdApi.Incident) error {
+	r := make(map[string][]pdApi.Incident)
+	r["incidents"] = incidents
+	headers := map[string]string{"From": from}
+	return discardResponse(c.putWithContext(ctx, "/incidents", r, headers))
+}
+
+// CreateMaintenanceWindows creates a new maintenance window for the specified services.
+func (c *Client) CreateMaintenanceWindows(m pdApi.MaintenanceWindow) (*pdApi.MaintenanceWindow, error) {
+	return c.CreateMaintenanceWindowsWithContext(context.Background(), m)
+}
+
+// CreateMaintenanceWindowsWithContext creates a new maintenance window for the specified services.
+func (c *Client) CreateMaintenanceWindowsWithContext(ctx context.Context, m pdApi.MaintenanceWindow) (*pdApi.MaintenanceWindow, error) {
+	data := make(map[string]pdApi.MaintenanceWindow)
+	data["maintenance_window"] = m
+	resp, err := c.postWithContext(ctx, "/maintenance_windows", data)
+	return maintenanceWindowFromResponse(c, resp, err)
+}
+
+// GetTeam gets details about an existing team.
+func (c *Client) GetTeam(id string) (*pdApi.Team, error) {
+	return c.GetTeamWithContext(context.Background(), id)
+}
+
+// GetTeamWithContext gets details about an existing team.
+func (c *Client) GetTeamWithContext(ctx context.Context, id string) (*pdApi.Team, error) {
+	resp, err := c.getWithContext(ctx, "/teams/"+id)
+	return teamFromResponse(c, resp, err)
+}
+
+// GetVendor gets details about an existing vendor.
+func (c *Client) GetVendor(id string) (*pdApi.Vendor, error) {
+	return c.GetVendorWithContext(context.Background(), id)
+}
+
+// GetVendorWithContext gets details about an existing vendor.
+func (c *Client) GetVendorWithContext(ctx context.Context, id string) (*pdApi.Vendor, error) {
+	resp, err := c.getWithContext(ctx, "/vendors/"+id)
+	return vendorFromResponse(c, resp, err)
+}
+
+func serviceFromResponse(c *Client, resp *http.Response, err error) (*pdApi.Service, error) {
+	if err != nil {
+		return nil, err
+	}
+	var target map[string]pdApi.Service
+	if dErr := c.decodeJSON(resp, &target); dErr != nil {
+		return nil, fmt.Errorf("Could not decode JSON response: %v", dErr)
+	}
+	rootNode := "service"
+	t, nodeOK := target[rootNode]
+	if !nodeOK {
+		return nil, fmt.Errorf("JSON response does not have %s field", rootNode)
+	}
+	return &t, nil
+}
+
+func integrationFromResponse(c *Client, resp *http.Response, err error) (*pdApi.Integration, error) {
+	if err != nil {
+		return nil, err
+	}
+	var target map[string]pdApi.Integration
+	if dErr := c.decodeJSON(resp, &target); dErr != nil {
+		return nil, fmt.Errorf("Could not decode JSON response: %v", dErr)
+	}
+	rootNode := "integration"
+	t, nodeOK := target[rootNode]
+	if !nodeOK {
+		return nil, fmt.Errorf("JSON response does not have %s field", rootNode)
+	}
+	return &t, nil
+}
+
+func escalationPolicyFromResponse(c *Client, resp *http.Response, err error) (*pdApi.EscalationPolicy, error) {
+	if err != nil {
+		return nil, err
+	}
+	var target map[string]pdApi.EscalationPolicy
+	if dErr := c.decodeJSON(resp, &target); dErr != nil {
+		return nil, fmt.Errorf("Could not decode JSON response: %v", dErr)
+	}
+	rootNode := "escalation_policy"
+	t, nodeOK := target[rootNode]
+	if !nodeOK {
+		return nil, fmt.Errorf("JSON response does not have %s field", rootNode)
+	}
+	return &t, nil
+}
+
+func maintenanceWindowFromResponse(c *Client, resp *http.Response, err error) (*pdApi.MaintenanceWindow, error) {
+	if err != nil {
+		return nil, err
+	}
+	var target map[string]pdApi.MaintenanceWindow
+	if dErr := c.decodeJSON(resp, &target); dErr != nil {
+		return nil, fmt.Errorf("Could not decode JSON response: %v", dErr)
+	}
+	rootNode := "maintenance_window"
+	t, nodeOK := target[rootNode]
+	if !nodeOK {
+		return nil, fmt.Errorf("JSON response does not have %s field", rootNode)
+	}
+	return &t, nil
+}
+
+func teamFromResponse(c *Client, resp *http.Response, err error) (*pdApi.Team, error) {
+	if err != nil {
+		return nil, err
+	}
+	var target map[string]pdApi.Team
+	if dErr := c.decodeJSON(resp, &target); dErr != nil {
+		return nil, fmt.Errorf("Could not decode JSON response: %v", dErr)
+	}
+	rootNode := "team"
+	t, nodeOK := target[rootNode]
+	if !nodeOK {
+		return nil, fmt.Errorf("JSON response does not have %s field", rootNode)
+	}
+	return &t, nil
+}
+
+func vendorFromResponse(c *Client, resp *http.Response, err error) (*pdApi.Vendor, error) {
+	if err != nil {
+		return nil, err
+	}
+	var target map[string]pdApi.Vendor
+	if dErr := c.decodeJSON(resp, &target); dErr != nil {
+		return nil, fmt.Errorf("Could not decode JSON response: %v", dErr)
+	}
+	rootNode := "vendor"
+	t, nodeOK := target[rootNode]
+	if !nodeOK {
+		return nil, fmt.Errorf("JSON response does not have %s field", rootNode)
+	}
+	return &t, nil
+}
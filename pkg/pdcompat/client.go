@@ -0,0 +1,234 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pdcompat is a compatibility layer over the vendored go-pagerduty
+// types. The vendored 1.0.4 release lacks client features the operator
+// needs — context-aware calls, a configurable api endpoint and HTTP client,
+// a User-Agent header and OAuth bearer authentication — so the thin HTTP
+// layer is reimplemented here on top of the vendored request and response
+// types. The method and option shape deliberately mirrors upstream so this
+// package can be dropped once a release providing them is vendored.
+package pdcompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// defaultAPIEndpoint is the public PagerDuty api
+const defaultAPIEndpoint = "https://api.pagerduty.com"
+
+// authType selects how the Authorization header is built
+type authType int
+
+const (
+	// apiToken authenticates with an account/user api token
+	apiToken authType = iota
+	// oauthToken authenticates with an OAuth bearer token
+	oauthToken
+)
+
+type errorObject struct {
+	Code    int         `json:"code,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Errors  interface{} `json:"errors,omitempty"`
+}
+
+// Client makes PagerDuty api calls using the vendored go-pagerduty types
+type Client struct {
+	authToken   string
+	apiEndpoint string
+	authType    authType
+	userAgent   string
+	httpClient  *http.Client
+}
+
+// ClientOptions customizes a Client at construction time
+type ClientOptions func(*Client)
+
+// WithAPIEndpoint points the client at a custom api endpoint, e.g. a mock
+// server in tests
+func WithAPIEndpoint(endpoint string) ClientOptions {
+	return func(c *Client) {
+		c.apiEndpoint = endpoint
+	}
+}
+
+// WithHTTPClient makes requests with the given HTTP client, e.g. one with a
+// timeout set
+func WithHTTPClient(client *http.Client) ClientOptions {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent on every request, so api
+// admins can tell callers apart
+func WithUserAgent(agent string) ClientOptions {
+	return func(c *Client) {
+		c.userAgent = agent
+	}
+}
+
+// WithOAuth authenticates with an OAuth bearer token instead of an api token
+func WithOAuth() ClientOptions {
+	return func(c *Client) {
+		c.authType = oauthToken
+	}
+}
+
+// NewClient creates a client authenticating with an account/user api token
+func NewClient(authToken string, options ...ClientOptions) *Client {
+	client := Client{
+		authToken:   authToken,
+		apiEndpoint: defaultAPIEndpoint,
+		authType:    apiToken,
+	}
+	for _, opt := range options {
+		opt(&client)
+	}
+	return &client
+}
+
+// NewOAuthClient creates a client authenticating with an OAuth token
+func NewOAuthClient(authToken string, options ...ClientOptions) *Client {
+	return NewClient(authToken, append(options, WithOAuth())...)
+}
+
+func (c *Client) deleteWithContext(ctx context.Context, path string) (*http.Response, error) {
+	return c.do(ctx, "DELETE", path, nil, nil)
+}
+
+func (c *Client) putWithContext(ctx context.Context, path string, payload interface{}, headers map[string]string) (*http.Response, error) {
+	if payload == nil {
+		return c.do(ctx, "PUT", path, nil, headers)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, "PUT", path, bytes.NewBuffer(data), headers)
+}
+
+func (c *Client) postWithContext(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, "POST", path, bytes.NewBuffer(data), nil)
+}
+
+func (c *Client) getWithContext(ctx context.Context, path string) (*http.Response, error) {
+	return c.do(ctx, "GET", path, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.apiEndpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	switch c.authType {
+	case oauthToken:
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	default:
+		req.Header.Set("Authorization", "Token token="+c.authToken)
+	}
+
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	return c.checkResponse(resp, err)
+}
+
+func (c *Client) decodeJSON(resp *http.Response, payload interface{}) error {
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(payload)
+}
+
+// APIError is the error returned for a non-2xx api response. The error text
+// keeps the upstream client's format for compatibility; the status code and
+// the Retry-After hint are exposed as fields so callers can use errors.As
+// instead of parsing the message.
+type APIError struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// RetryAfter is the Retry-After header in seconds, 0 when the
+	// response carried none
+	RetryAfter int
+	message    string
+}
+
+func (e *APIError) Error() string {
+	return e.message
+}
+
+// checkResponse turns a non-2xx response into an *APIError
+func (c *Client) checkResponse(resp *http.Response, err error) (*http.Response, error) {
+	if err != nil {
+		return resp, fmt.Errorf("Error calling the API endpoint: %v", err)
+	}
+	if 199 >= resp.StatusCode || 300 <= resp.StatusCode {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+			apiErr.RetryAfter = seconds
+		}
+		var eo *errorObject
+		var getErr error
+		if eo, getErr = c.getErrorFromResponse(resp); getErr != nil {
+			apiErr.message = fmt.Sprintf("Response did not contain formatted error: %s. HTTP response code: %v. Raw response: %+v", getErr, resp.StatusCode, resp)
+		} else {
+			apiErr.message = fmt.Sprintf("Failed call API endpoint. HTTP response code: %v. Error: %v", resp.StatusCode, eo)
+		}
+		return resp, apiErr
+	}
+	return resp, nil
+}
+
+func (c *Client) getErrorFromResponse(resp *http.Response) (*errorObject, error) {
+	var result map[string]errorObject
+	if err := c.decodeJSON(resp, &result); err != nil {
+		return nil, fmt.Errorf("Could not decode JSON response: %v", err)
+	}
+	eo, ok := result["error"]
+	if !ok {
+		return nil, fmt.Errorf("JSON response does not have error field")
+	}
+	return &eo, nil
+}
+
+// discardResponse closes the body of a response whose payload the caller
+// does not need
+func discardResponse(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
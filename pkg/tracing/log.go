@@ -0,0 +1,91 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// NewLogTracer returns a Tracer that emits every finished span as one
+// structured log entry: operation, duration, parent operation and any tags
+// and events. It is the exporter of last resort, turning spans into
+// greppable log lines when no tracing backend is deployed.
+func NewLogTracer(logger logr.Logger) Tracer {
+	return &logTracer{logger: logger}
+}
+
+type logTracer struct {
+	logger logr.Logger
+}
+
+func (t *logTracer) StartSpan(operationName string, parent Span) Span {
+	return &logSpan{
+		tracer:    t,
+		operation: operationName,
+		parent:    parent,
+		start:     time.Now(),
+	}
+}
+
+// logSpan buffers tags and events until Finish, which writes the single log
+// entry for the span
+type logSpan struct {
+	tracer    *logTracer
+	operation string
+	parent    Span
+	start     time.Time
+
+	mux    sync.Mutex
+	fields []interface{}
+}
+
+func (s *logSpan) SetTag(key string, value interface{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.fields = append(s.fields, key, value)
+}
+
+func (s *logSpan) LogKV(alternatingKeyValues ...interface{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i := 0; i < len(alternatingKeyValues); i += 2 {
+		// logr requires string keys; coerce anything else.
+		key := fmt.Sprintf("%v", alternatingKeyValues[i])
+		var value interface{}
+		if i+1 < len(alternatingKeyValues) {
+			value = alternatingKeyValues[i+1]
+		}
+		s.fields = append(s.fields, key, value)
+	}
+}
+
+func (s *logSpan) Finish() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	keysAndValues := []interface{}{
+		"operation", s.operation,
+		"duration", time.Since(s.start).String(),
+	}
+	if parent, ok := s.parent.(*logSpan); ok && parent != nil {
+		keysAndValues = append(keysAndValues, "parent", parent.operation)
+	}
+	keysAndValues = append(keysAndValues, s.fields...)
+	s.tracer.logger.Info("span finished", keysAndValues...)
+}
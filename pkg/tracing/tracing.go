@@ -0,0 +1,89 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing provides the span primitives the operator instruments its
+// PagerDuty and Vault calls with. The interface follows the OpenTracing
+// shape (StartSpanFromContext, SetTag, LogKV, Finish) so a real tracer can
+// be plugged in through SetGlobalTracer. NewLogTracer ships as the built-in
+// exporter — main installs it when OPERATOR_TRACING=log — and until a
+// tracer is installed spans are no-ops.
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// Span records one traced operation
+type Span interface {
+	// SetTag attaches a key/value tag to the span
+	SetTag(key string, value interface{})
+	// LogKV records a timestamped event on the span from alternating keys
+	// and values
+	LogKV(alternatingKeyValues ...interface{})
+	// Finish marks the end of the span; it must be called exactly once
+	Finish()
+}
+
+// Tracer creates spans. parent is the enclosing span, or nil at the root of
+// an operation.
+type Tracer interface {
+	StartSpan(operationName string, parent Span) Span
+}
+
+var (
+	globalTracer    Tracer = noopTracer{}
+	globalTracerMux sync.Mutex
+)
+
+// SetGlobalTracer installs the tracer used by StartSpanFromContext, e.g. at
+// operator startup once an exporter is configured
+func SetGlobalTracer(tracer Tracer) {
+	globalTracerMux.Lock()
+	defer globalTracerMux.Unlock()
+
+	globalTracer = tracer
+}
+
+func getGlobalTracer() Tracer {
+	globalTracerMux.Lock()
+	defer globalTracerMux.Unlock()
+
+	return globalTracer
+}
+
+// activeSpanKey carries the current span through a context
+type activeSpanKey struct{}
+
+// StartSpanFromContext starts a span named operationName, parented to the
+// span already carried by ctx when there is one, and returns a context
+// carrying the new span for further nesting
+func StartSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	parent, _ := ctx.Value(activeSpanKey{}).(Span)
+	span := getGlobalTracer().StartSpan(operationName, parent)
+	return span, context.WithValue(ctx, activeSpanKey{}, span)
+}
+
+// noopTracer is the default tracer; it discards everything
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(operationName string, parent Span) Span {
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetTag(key string, value interface{})      {}
+func (noopSpan) LogKV(alternatingKeyValues ...interface{}) {}
+func (noopSpan) Finish()                                   {}
@@ -0,0 +1,445 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stsEndpoint returns the STS endpoint and the signing region. With
+// AWS_REGION (or AWS_DEFAULT_REGION) set the regional endpoint is used,
+// which keeps the call inside the region and works with private STS VPC
+// endpoints; without a region the global endpoint signs as us-east-1.
+func stsEndpoint() (endpoint string, region string) {
+	region = os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return "https://sts.amazonaws.com/", "us-east-1"
+	}
+	return "https://sts." + region + ".amazonaws.com/", region
+}
+
+// metadataTimeout bounds calls to the link-local credential endpoints so a
+// chain lookup off EC2/ECS fails fast instead of hanging the login
+const metadataTimeout = 2 * time.Second
+
+// awsCredentials are the pieces of an AWS credential set needed to sign a
+// request
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// roleCredentialsDoc is the JSON document both the ECS credentials endpoint
+// and the EC2 instance metadata service return for a role
+type roleCredentialsDoc struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+}
+
+// awsLoginCredentials resolves credentials in the same order as the aws
+// sdk's default chain: static environment keys, a web identity (IRSA), the
+// shared credentials file, container (ECS) credentials and finally the EC2
+// instance metadata service. The sdk itself is not vendored — it would be a
+// very large dependency for the one signed request Vault needs — so the
+// chain is implemented directly.
+func awsLoginCredentials() (*awsCredentials, error) {
+	if accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyID != "" {
+		secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if secretAccessKey == "" {
+			return nil, errors.New("AWS_ACCESS_KEY_ID is set but AWS_SECRET_ACCESS_KEY is not")
+		}
+		return &awsCredentials{
+			accessKeyID:     accessKeyID,
+			secretAccessKey: secretAccessKey,
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	roleARN := os.Getenv("AWS_ROLE_ARN")
+	if tokenFile != "" && roleARN != "" {
+		return assumeRoleWithWebIdentity(tokenFile, roleARN)
+	}
+
+	if creds := sharedFileCredentials(); creds != nil {
+		return creds, nil
+	}
+
+	if endpoint := containerCredentialsEndpoint(); endpoint != "" {
+		return fetchRoleCredentials(endpoint, os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"), nil)
+	}
+
+	creds, imdsErr := instanceMetadataCredentials()
+	if imdsErr == nil {
+		return creds, nil
+	}
+	return nil, fmt.Errorf("no aws credentials: no static keys, web identity, shared credentials file or container credentials, and the instance metadata service gave none: %v", imdsErr)
+}
+
+// assumeRoleWithWebIdentity trades the pod's projected service account token
+// for temporary role credentials. The call itself is unsigned; the token is
+// the credential.
+func assumeRoleWithWebIdentity(tokenFile string, roleARN string) (*awsCredentials, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read web identity token: %v", err)
+	}
+
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = "pagerduty-operator"
+	}
+
+	params := url.Values{}
+	params.Set("Action", "AssumeRoleWithWebIdentity")
+	params.Set("Version", "2011-06-15")
+	params.Set("RoleArn", roleARN)
+	params.Set("RoleSessionName", sessionName)
+	params.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	endpoint, _ := stsEndpoint()
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("web identity exchange failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("web identity exchange failed: HTTP %v", resp.StatusCode)
+	}
+
+	var result struct {
+		AssumeRoleWithWebIdentityResponse struct {
+			AssumeRoleWithWebIdentityResult struct {
+				Credentials struct {
+					AccessKeyId     string
+					SecretAccessKey string
+					SessionToken    string
+				}
+			}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode web identity response: %v", err)
+	}
+
+	creds := result.AssumeRoleWithWebIdentityResponse.AssumeRoleWithWebIdentityResult.Credentials
+	if creds.AccessKeyId == "" {
+		return nil, errors.New("web identity exchange returned no credentials")
+	}
+	return &awsCredentials{
+		accessKeyID:     creds.AccessKeyId,
+		secretAccessKey: creds.SecretAccessKey,
+		sessionToken:    creds.SessionToken,
+	}, nil
+}
+
+// sharedFileCredentials reads the shared credentials file the aws CLI
+// maintains, honoring AWS_SHARED_CREDENTIALS_FILE and AWS_PROFILE. A
+// missing or unparseable file just moves the chain along, so the return is
+// nil rather than an error.
+func sharedFileCredentials() *awsCredentials {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = home + "/.aws/credentials"
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	creds := parseCredentialsFile(string(raw), profile)
+	if creds == nil || creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return nil
+	}
+	return creds
+}
+
+// parseCredentialsFile extracts one profile from the ini-style shared
+// credentials file, returning nil when the profile has no credential keys
+func parseCredentialsFile(content string, profile string) *awsCredentials {
+	creds := &awsCredentials{}
+	inProfile := false
+	found := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			continue
+		}
+		if !inProfile {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "aws_access_key_id":
+			creds.accessKeyID = strings.TrimSpace(parts[1])
+			found = true
+		case "aws_secret_access_key":
+			creds.secretAccessKey = strings.TrimSpace(parts[1])
+			found = true
+		case "aws_session_token":
+			creds.sessionToken = strings.TrimSpace(parts[1])
+		}
+	}
+	if !found {
+		return nil
+	}
+	return creds
+}
+
+// containerCredentialsEndpoint returns the ECS task role credentials url, or
+// empty when the task has none configured
+func containerCredentialsEndpoint() string {
+	if full := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); full != "" {
+		return full
+	}
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		return "http://169.254.170.2" + relative
+	}
+	return ""
+}
+
+// fetchRoleCredentials GETs a role credentials document, as served by the
+// ECS credentials endpoint and the EC2 instance metadata service
+func fetchRoleCredentials(endpoint string, authorization string, headers http.Header) (*awsCredentials, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	client := &http.Client{Timeout: metadataTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching role credentials failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching role credentials failed: HTTP %v", resp.StatusCode)
+	}
+
+	var doc roleCredentialsDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode role credentials: %v", err)
+	}
+	if doc.AccessKeyId == "" {
+		return nil, errors.New("role credentials response held no credentials")
+	}
+	return &awsCredentials{
+		accessKeyID:     doc.AccessKeyId,
+		secretAccessKey: doc.SecretAccessKey,
+		sessionToken:    doc.Token,
+	}, nil
+}
+
+// instanceMetadataCredentials fetches the instance role credentials from the
+// EC2 metadata service using an IMDSv2 session token
+func instanceMetadataCredentials() (*awsCredentials, error) {
+	client := &http.Client{Timeout: metadataTimeout}
+
+	tokenReq, err := http.NewRequest("PUT", "http://169.254.169.254/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	tokenResp, err := client.Do(tokenReq)
+	if err != nil {
+		return nil, fmt.Errorf("instance metadata service unreachable: %v", err)
+	}
+	token, err := ioutil.ReadAll(tokenResp.Body)
+	tokenResp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if tokenResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("instance metadata token request failed: HTTP %v", tokenResp.StatusCode)
+	}
+
+	imdsHeader := http.Header{}
+	imdsHeader.Set("X-aws-ec2-metadata-token", strings.TrimSpace(string(token)))
+
+	roleReq, err := http.NewRequest("GET", "http://169.254.169.254/latest/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return nil, err
+	}
+	roleReq.Header = imdsHeader.Clone()
+	roleResp, err := client.Do(roleReq)
+	if err != nil {
+		return nil, fmt.Errorf("listing instance roles failed: %v", err)
+	}
+	roleRaw, err := ioutil.ReadAll(roleResp.Body)
+	roleResp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if roleResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing instance roles failed: HTTP %v", roleResp.StatusCode)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roleRaw), "\n", 2)[0])
+	if role == "" {
+		return nil, errors.New("the instance has no iam role attached")
+	}
+
+	return fetchRoleCredentials("http://169.254.169.254/latest/meta-data/iam/security-credentials/"+role, "", imdsHeader)
+}
+
+// awsLoginPayload builds the signed STS GetCallerIdentity request Vault's
+// aws auth method verifies. Credentials come from the default-chain lookup,
+// so no long-lived secret has to be stored.
+func awsLoginPayload(role string) (map[string]interface{}, error) {
+	creds, err := awsLoginCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, region := stsEndpoint()
+	body := "Action=GetCallerIdentity&Version=2011-06-15"
+	header, err := signSTSRequest(creds, endpoint, region, body, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"role":                    role,
+		"iam_http_request_method": "POST",
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(endpoint)),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+		"iam_request_body":        base64.StdEncoding.EncodeToString([]byte(body)),
+	}, nil
+}
+
+// signSTSRequest returns the headers of a sigv4-signed POST of body to the
+// given STS endpoint
+func signSTSRequest(creds *awsCredentials, endpoint string, region string, body string, now time.Time) (http.Header, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	path := endpointURL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	header.Set("Host", endpointURL.Host)
+	header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	signedHeaderNames := make([]string, 0, len(header))
+	for name := range header {
+		signedHeaderNames = append(signedHeaderNames, strings.ToLower(name))
+	}
+	sort.Strings(signedHeaderNames)
+	signedHeaders := strings.Join(signedHeaderNames, ";")
+
+	canonicalHeaders := ""
+	for _, name := range signedHeaderNames {
+		canonicalHeaders += name + ":" + strings.TrimSpace(header.Get(name)) + "\n"
+	}
+
+	// Canonical request per the sigv4 spec: method, path, query string,
+	// headers, signed header list and payload hash, newline separated.
+	payloadHash := sha256.Sum256([]byte(body))
+	canonicalRequest := strings.Join([]string{
+		"POST",
+		path,
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := shortDate + "/" + region + "/sts/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), shortDate)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "sts")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		creds.accessKeyID, scope, signedHeaders, signature))
+	return header, nil
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
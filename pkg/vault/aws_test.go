@@ -0,0 +1,61 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import "testing"
+
+func TestParseCredentialsFile(t *testing.T) {
+	content := `
+# comment
+[default]
+aws_access_key_id = AKIADEFAULT
+aws_secret_access_key = default-secret
+
+[other]
+aws_access_key_id=AKIAOTHER
+aws_secret_access_key=other-secret
+aws_session_token=other-token
+`
+
+	creds := parseCredentialsFile(content, "default")
+	if creds == nil || creds.accessKeyID != "AKIADEFAULT" || creds.secretAccessKey != "default-secret" {
+		t.Errorf("default profile parsed as %+v", creds)
+	}
+
+	creds = parseCredentialsFile(content, "other")
+	if creds == nil || creds.accessKeyID != "AKIAOTHER" || creds.sessionToken != "other-token" {
+		t.Errorf("other profile parsed as %+v", creds)
+	}
+
+	if creds := parseCredentialsFile(content, "missing"); creds != nil {
+		t.Errorf("expected nil for an absent profile, got %+v", creds)
+	}
+}
+
+func TestSTSEndpointHonorsRegion(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	endpoint, region := stsEndpoint()
+	if endpoint != "https://sts.amazonaws.com/" || region != "us-east-1" {
+		t.Errorf("expected the global endpoint without a region, got %v signing as %v", endpoint, region)
+	}
+
+	t.Setenv("AWS_REGION", "eu-west-1")
+	endpoint, region = stsEndpoint()
+	if endpoint != "https://sts.eu-west-1.amazonaws.com/" || region != "eu-west-1" {
+		t.Errorf("expected the regional endpoint, got %v signing as %v", endpoint, region)
+	}
+}
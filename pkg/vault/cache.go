@@ -0,0 +1,309 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/pagerduty-operator/config"
+)
+
+// Cache is a pluggable store for fetched Vault secrets. Implementations own
+// the staleness logic: Get never returns an expired entry.
+type Cache interface {
+	// Get returns the cached value for key, reporting false when the
+	// entry is absent, stale or unreadable
+	Get(key string) (string, bool)
+	// Set stores value under key for at most ttl
+	Set(key string, value string, ttl time.Duration) error
+	// Invalidate drops the entry for key; a missing entry is not an error
+	Invalidate(key string) error
+}
+
+// cacheBackendImpl returns the cache backend for this Data: an explicitly
+// injected one wins, otherwise VAULT_CACHE_BACKEND selects between the file
+// and Kubernetes Secret implementations
+func (data *Data) cacheBackendImpl(osc client.Client) Cache {
+	if data.CacheBackend != nil {
+		return data.CacheBackend
+	}
+	if data.cacheBackend == "secret" {
+		return &secretCache{data: data, osc: osc}
+	}
+	if data.cacheBackend == "redis" {
+		return data.getRedisCache()
+	}
+	return &fileCache{data: data}
+}
+
+// getRedisCache returns the shared redis backend, creating its connection
+// pool on first use
+func (data *Data) getRedisCache() *redisCache {
+	data.clientMux.Lock()
+	defer data.clientMux.Unlock()
+
+	if data.redisCache == nil {
+		data.redisCache = &redisCache{
+			data:   data,
+			client: newRedisClient(data.redisAddr),
+		}
+	}
+	return data.redisCache
+}
+
+// fileCache is the default backend, keeping one file per entry under the
+// cache directory. The expiry is tracked in a sidecar file so per-entry TTLs
+// survive process restarts; entries written before sidecars existed fall
+// back to the mtime check against the global TTL.
+type fileCache struct {
+	data *Data
+}
+
+func (c *fileCache) entryPath(key string) string {
+	return c.data.cacheDir + "/" + key
+}
+
+func (c *fileCache) Get(key string) (string, bool) {
+	path := c.entryPath(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		log.V(1).Info("vault cache miss", "key", key, "reason", "missing")
+		return "", false
+	}
+	// A future mtime, e.g. after a node clock jump, marks the entry
+	// stale no matter what the sidecar says.
+	if info.ModTime().After(time.Now()) {
+		log.V(1).Info("vault cache miss", "key", key, "reason", "future mtime")
+		return "", false
+	}
+
+	if expiresRaw, readErr := ioutil.ReadFile(path + ".expires"); readErr == nil {
+		expires, parseErr := time.Parse(time.RFC3339, strings.TrimSpace(string(expiresRaw)))
+		if parseErr != nil || !time.Now().Before(expires) {
+			log.V(1).Info("vault cache miss", "key", key, "reason", "expired")
+			return "", false
+		}
+	} else if !cacheFresh(info, c.data.cacheTTL) {
+		log.V(1).Info("vault cache miss", "key", key, "reason", "expired")
+		return "", false
+	}
+
+	value, err := c.data.readCachedSecret(path)
+	if err != nil {
+		log.V(1).Info("vault cache miss", "key", key, "reason", "corrupt")
+		return "", false
+	}
+	if value == "" {
+		// A zero-byte entry, e.g. left by a crashed write, is not a
+		// valid secret. Drop it so the next write starts clean.
+		c.Invalidate(key)
+		log.V(1).Info("vault cache miss", "key", key, "reason", "empty")
+		return "", false
+	}
+	return value, true
+}
+
+func (c *fileCache) Set(key string, value string, ttl time.Duration) error {
+	path := c.entryPath(key)
+	if err := c.data.writeCachedSecret(path, value); err != nil {
+		return err
+	}
+	return saveSecret(path+".expires", time.Now().Add(ttl).Format(time.RFC3339))
+}
+
+func (c *fileCache) Invalidate(key string) error {
+	path := c.entryPath(key)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(path + ".expires"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// vaultCacheSecretName is the Kubernetes Secret the secret cache backend
+// stores fetched values in
+const vaultCacheSecretName = "pagerduty-vault-cache"
+
+// expiresAnnotationPrefix prefixes the per-entry annotation recording when
+// a value expires, completed with the entry's path hash
+const expiresAnnotationPrefix = "pagerduty.openshift.io/expires-at-"
+
+// cacheKeyHash returns the path hash suffix of a cache key, used to build
+// annotation names that stay within the length limit
+func cacheKeyHash(key string) string {
+	if i := strings.LastIndex(key, "-"); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
+
+// secretCache stores entries in a Kubernetes Secret owned by the operator,
+// so the cache survives pod restarts and works with read-only root
+// filesystems. Expiry is tracked per entry in an annotation. Writes are
+// best-effort: replicas share the Secret, so conflicts are logged and
+// dropped rather than failing the caller.
+type secretCache struct {
+	data *Data
+	osc  client.Client
+}
+
+func (c *secretCache) Get(key string) (string, bool) {
+	cacheSecret := &corev1.Secret{}
+	err := c.osc.Get(context.TODO(), types.NamespacedName{Namespace: config.OperatorNamespace, Name: vaultCacheSecretName}, cacheSecret)
+	if err != nil {
+		return "", false
+	}
+
+	value, ok := cacheSecret.Data[key]
+	if !ok || len(value) == 0 {
+		return "", false
+	}
+
+	expiresStr, ok := cacheSecret.Annotations[expiresAnnotationPrefix+cacheKeyHash(key)]
+	if !ok {
+		return "", false
+	}
+	expires, parseErr := time.Parse(time.RFC3339, expiresStr)
+	if parseErr != nil || !time.Now().Before(expires) {
+		return "", false
+	}
+
+	unsealed, err := c.data.unsealCacheValue(string(value))
+	if err != nil {
+		return "", false
+	}
+	return unsealed, true
+}
+
+func (c *secretCache) Set(key string, value string, ttl time.Duration) error {
+	sealed, err := c.data.sealCacheValue(value)
+	if err != nil {
+		return err
+	}
+
+	create := false
+	cacheSecret := &corev1.Secret{}
+	err = c.osc.Get(context.TODO(), types.NamespacedName{Namespace: config.OperatorNamespace, Name: vaultCacheSecretName}, cacheSecret)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			log.Info("failed to read the vault cache Secret, not caching", "error", err.Error())
+			return nil
+		}
+		create = true
+		cacheSecret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: config.OperatorNamespace,
+				Name:      vaultCacheSecretName,
+			},
+		}
+	}
+
+	if cacheSecret.Data == nil {
+		cacheSecret.Data = map[string][]byte{}
+	}
+	if cacheSecret.Annotations == nil {
+		cacheSecret.Annotations = map[string]string{}
+	}
+	cacheSecret.Data[key] = []byte(sealed)
+	cacheSecret.Annotations[expiresAnnotationPrefix+cacheKeyHash(key)] = time.Now().Add(ttl).Format(time.RFC3339)
+
+	if create {
+		err = c.osc.Create(context.TODO(), cacheSecret)
+	} else {
+		err = c.osc.Update(context.TODO(), cacheSecret)
+	}
+	if err != nil {
+		// Replicas share this Secret, so conflicting writes are routine.
+		// Losing one write only costs the next reader a Vault round trip
+		// and must not fail the read that produced the value.
+		log.Info("failed to cache secret in the vault cache Secret, continuing", "error", err.Error())
+	}
+	return nil
+}
+
+func (c *secretCache) Invalidate(key string) error {
+	cacheSecret := &corev1.Secret{}
+	err := c.osc.Get(context.TODO(), types.NamespacedName{Namespace: config.OperatorNamespace, Name: vaultCacheSecretName}, cacheSecret)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	delete(cacheSecret.Data, key)
+	delete(cacheSecret.Annotations, expiresAnnotationPrefix+cacheKeyHash(key))
+	return c.osc.Update(context.TODO(), cacheSecret)
+}
+
+// redisKeyPrefix namespaces the operator's entries in a potentially shared
+// redis instance
+const redisKeyPrefix = "pagerduty-operator/vault-cache/"
+
+// redisCache shares one secret cache across operator replicas. Redis being
+// unreachable is never fatal: Get reports a miss and Set logs and moves on,
+// so reads fall through to Vault instead of erroring. Values pass through
+// sealCacheValue, so with encryption enabled redis only ever sees ciphertext.
+type redisCache struct {
+	data   *Data
+	client *redisClient
+}
+
+func (c *redisCache) Get(key string) (string, bool) {
+	value, err := c.client.Get(redisKeyPrefix + key)
+	if err != nil {
+		if err != errRedisNil {
+			log.Info("redis cache unavailable, falling through to vault", "error", err.Error())
+		}
+		return "", false
+	}
+	if value == "" {
+		return "", false
+	}
+	unsealed, err := c.data.unsealCacheValue(value)
+	if err != nil {
+		return "", false
+	}
+	return unsealed, true
+}
+
+func (c *redisCache) Set(key string, value string, ttl time.Duration) error {
+	sealed, err := c.data.sealCacheValue(value)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(redisKeyPrefix+key, sealed, ttl); err != nil {
+		// A failed cache write only costs the next reader a Vault round
+		// trip; it must not fail the read that produced the value.
+		log.Info("failed to cache secret in redis, continuing", "error", err.Error())
+	}
+	return nil
+}
+
+func (c *redisCache) Invalidate(key string) error {
+	return c.client.Del(redisKeyPrefix + key)
+}
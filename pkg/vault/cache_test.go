@@ -0,0 +1,126 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// testFileCache returns a file cache rooted in a fresh temporary directory.
+// The caller must invoke the returned cleanup function.
+func testFileCache(t *testing.T) (*fileCache, func()) {
+	dir, err := ioutil.TempDir("", "vault-cache")
+	if err != nil {
+		t.Fatalf("failed to create cache dir: %v", err)
+	}
+
+	cache := &fileCache{
+		data: &Data{
+			cacheDir: dir,
+			cacheTTL: time.Hour,
+		},
+	}
+	return cache, func() { os.RemoveAll(dir) }
+}
+
+func TestFileCacheRoundTrip(t *testing.T) {
+	cache, cleanup := testFileCache(t)
+	defer cleanup()
+
+	if _, ok := cache.Get("entry"); ok {
+		t.Error("expected a miss before the first Set")
+	}
+
+	if err := cache.Set("entry", "secret-value", time.Minute); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	value, ok := cache.Get("entry")
+	if !ok {
+		t.Fatal("expected a hit after Set")
+	}
+	if value != "secret-value" {
+		t.Errorf("expected secret-value, got %v", value)
+	}
+
+	if err := cache.Invalidate("entry"); err != nil {
+		t.Fatalf("Invalidate returned error: %v", err)
+	}
+	if _, ok := cache.Get("entry"); ok {
+		t.Error("expected a miss after Invalidate")
+	}
+
+	// Invalidating an entry that is already gone is not an error.
+	if err := cache.Invalidate("entry"); err != nil {
+		t.Errorf("Invalidate of a missing entry returned error: %v", err)
+	}
+}
+
+func TestFileCacheExpiredEntryMisses(t *testing.T) {
+	cache, cleanup := testFileCache(t)
+	defer cleanup()
+
+	// A negative TTL writes an expiry sidecar that is already in the past.
+	if err := cache.Set("entry", "secret-value", -time.Second); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	if _, ok := cache.Get("entry"); ok {
+		t.Error("expected an expired entry to miss")
+	}
+}
+
+func TestFileCacheEmptyEntryMisses(t *testing.T) {
+	cache, cleanup := testFileCache(t)
+	defer cleanup()
+
+	if err := cache.Set("entry", "secret-value", time.Minute); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	// Truncate the entry in place, as a write interrupted mid-flight would.
+	path := cache.entryPath("entry")
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("failed to truncate cache entry: %v", err)
+	}
+
+	if _, ok := cache.Get("entry"); ok {
+		t.Error("expected an empty entry to miss")
+	}
+	// The miss must also have dropped the entry so the next write starts
+	// clean.
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected the empty entry to be invalidated")
+	}
+}
+
+func TestFileCacheFutureMtimeMisses(t *testing.T) {
+	cache, cleanup := testFileCache(t)
+	defer cleanup()
+
+	if err := cache.Set("entry", "secret-value", time.Minute); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	// Push the entry's mtime into the future, as a node clock jump or a
+	// restored backup would.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(cache.entryPath("entry"), future, future); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+
+	if _, ok := cache.Get("entry"); ok {
+		t.Error("expected a future-dated entry to miss")
+	}
+}
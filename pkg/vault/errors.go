@@ -0,0 +1,69 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	api "github.com/openshift/pagerduty-operator/pkg/vaultapi"
+)
+
+// Sentinel errors callers can match with errors.Is to decide whether to
+// requeue quickly or back off.
+var (
+	// ErrVaultNotFound means the secret path does not exist
+	ErrVaultNotFound = errors.New("secret not found in vault")
+
+	// ErrVaultPermission means the token is not allowed to read the path
+	ErrVaultPermission = errors.New("permission denied by vault")
+
+	// ErrVaultUnavailable means Vault could not be reached or failed
+	// server-side
+	ErrVaultUnavailable = errors.New("vault is unavailable")
+
+	// ErrPropertyNotSet means the secret exists but the requested property
+	// is missing
+	ErrPropertyNotSet = errors.New("property not set in vault secret")
+)
+
+// classifyError maps a Vault api error onto the package's typed errors so
+// callers can react to the failure category
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if respErr, ok := err.(*api.ResponseError); ok {
+		switch {
+		case respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden:
+			return fmt.Errorf("%v: %w", err, ErrVaultPermission)
+		case respErr.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("%v: %w", err, ErrVaultNotFound)
+		case respErr.StatusCode >= 500:
+			return fmt.Errorf("%v: %w", err, ErrVaultUnavailable)
+		}
+		return err
+	}
+
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+
+	// Anything without a response is a connectivity problem.
+	return fmt.Errorf("%v: %w", err, ErrVaultUnavailable)
+}
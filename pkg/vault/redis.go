@@ -0,0 +1,153 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errRedisNil is returned by redisClient.Get when the key does not exist
+var errRedisNil = errors.New("redis: key does not exist")
+
+// redisServerError is an error reply (-ERR ...) from the server. The
+// connection stays usable after one.
+type redisServerError string
+
+func (e redisServerError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisClient speaks just enough of the RESP protocol for the cache: GET,
+// SET with an expiry, and DEL. One connection is kept open and shared under
+// a lock; an I/O error drops it so the next command redials.
+type redisClient struct {
+	addr string
+
+	mux    sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRedisClient(addr string) *redisClient {
+	return &redisClient{addr: addr}
+}
+
+// Get returns the value of key, or errRedisNil when it does not exist
+func (c *redisClient) Get(key string) (string, error) {
+	return c.do("GET", key)
+}
+
+// Set stores value under key, expiring after ttl when it is positive
+func (c *redisClient) Set(key string, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	_, err := c.do(args...)
+	return err
+}
+
+// Del removes key; deleting a missing key is not an error
+func (c *redisClient) Del(key string) error {
+	_, err := c.do("DEL", key)
+	return err
+}
+
+// do sends one command and reads its reply under the connection lock
+func (c *redisClient) do(args ...string) (string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.addr, 5*time.Second)
+		if err != nil {
+			return "", fmt.Errorf("failed to connect to redis at %v: %v", c.addr, err)
+		}
+		c.conn = conn
+		c.reader = bufio.NewReader(conn)
+	}
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var command bytes.Buffer
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write(command.Bytes()); err != nil {
+		c.dropConn()
+		return "", err
+	}
+
+	reply, err := c.readReply()
+	if err != nil && err != errRedisNil {
+		if _, serverSide := err.(redisServerError); !serverSide {
+			c.dropConn()
+		}
+	}
+	return reply, err
+}
+
+// readReply consumes one RESP reply from the connection
+func (c *redisClient) readReply() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", redisServerError(line[1:])
+	case '$':
+		length, convErr := strconv.Atoi(line[1:])
+		if convErr != nil {
+			return "", fmt.Errorf("redis: malformed bulk length %q", line[1:])
+		}
+		if length < 0 {
+			// A null bulk string, i.e. the key does not exist.
+			return "", errRedisNil
+		}
+		// The value is followed by a trailing CRLF.
+		value := make([]byte, length+2)
+		if _, err := io.ReadFull(c.reader, value); err != nil {
+			return "", err
+		}
+		return string(value[:length]), nil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// dropConn closes the connection so the next command reconnects
+func (c *redisClient) dropConn() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.reader = nil
+	}
+}
@@ -0,0 +1,1349 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift/pagerduty-operator/pkg/metrics"
+	"github.com/openshift/pagerduty-operator/pkg/tracing"
+	api "github.com/openshift/pagerduty-operator/pkg/vaultapi"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+var log = logf.Log.WithName("pagerduty_vault")
+
+// finishSpan closes a tracing span, marking it failed when the operation
+// returned an error
+func finishSpan(span tracing.Span, err error) {
+	if err != nil {
+		span.SetTag("error", true)
+		span.LogKV("message", err.Error())
+	}
+	span.Finish()
+}
+
+// serviceAccountTokenPath is where the pod's service account JWT is mounted
+const serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+func getSecretKey(data map[string][]byte, key string) (string, error) {
+	if _, ok := data[key]; !ok {
+		errorStr := fmt.Sprintf("%v does not exist", key)
+		return "", errors.New(errorStr)
+	}
+	retString := string(data[key])
+	if len(retString) <= 0 {
+		errorStr := fmt.Sprintf("%v is empty", key)
+		return "", errors.New(errorStr)
+	}
+	return retString, nil
+}
+
+// SecretRef names one (mount, path, property) tuple for
+// GetVaultSecretsMulti
+type SecretRef struct {
+	Mount    string
+	Path     string
+	Property string
+}
+
+// Data describes the data that is needed to fetch a secret from Vault
+type Data struct {
+	// SecretNamespace and SecretName locate the vault config secret
+	SecretNamespace string
+	SecretName      string
+
+	Mount    string
+	Path     string
+	Property string
+
+	// Refs are additional (mount, path, property) tuples read by
+	// GetVaultSecretsMulti with the same connection and auth config
+	Refs []SecretRef
+
+	// CacheBackend overrides the cache implementation selected by
+	// VAULT_CACHE_BACKEND, e.g. to plug in an external store
+	CacheBackend Cache
+
+	address    string
+	token      string
+	authMethod string
+	role       string
+	roleID     string
+	secretID   string
+	username   string
+	password   string
+	caCert     string
+	clientCert string
+	clientKey  string
+	skipVerify bool
+	kvVersion  int
+	version    string
+	cacheDir   string
+	cacheTTL   time.Duration
+	cacheTTLs  map[string]time.Duration
+
+	cacheEnabled bool
+	cacheEncrypt bool
+	cacheBackend string
+	redisAddr    string
+	tokenCheck   bool
+
+	// MaxRetryAttempts bounds how often a transient Vault failure is
+	// retried; zero means the default
+	MaxRetryAttempts int
+
+	retryBaseDelay time.Duration
+
+	client         *api.Client
+	clientMux      sync.Mutex
+	tokenTTL       time.Duration
+	tokenExpiry    time.Time
+	tokenRenewable bool
+
+	// leaseStop tears down lease renewal goroutines when the Data is
+	// closed
+	leaseStop chan struct{}
+
+	// redisCache is the lazily created redis cache backend
+	redisCache *redisCache
+}
+
+// parseVaultConfig reads the vault config secret and stores the connection
+// settings in the struct
+func (data *Data) parseVaultConfig(osc client.Client) error {
+	vaultConfigSecret := &corev1.Secret{}
+	err := osc.Get(context.TODO(), types.NamespacedName{Namespace: data.SecretNamespace, Name: data.SecretName}, vaultConfigSecret)
+	if err != nil {
+		// Development setups may configure vault entirely through the
+		// standard environment variables, without the secret.
+		if os.Getenv("VAULT_ADDR") == "" {
+			return err
+		}
+	}
+
+	data.address, err = getSecretKey(vaultConfigSecret.Data, "VAULT_ADDR")
+	if err != nil {
+		// The secret is authoritative; the environment is only consulted
+		// when it does not provide the key, mirroring the Vault CLI.
+		if envAddr := os.Getenv("VAULT_ADDR"); envAddr != "" {
+			data.address = envAddr
+		} else {
+			return err
+		}
+	}
+
+	data.authMethod, err = getSecretKey(vaultConfigSecret.Data, "VAULT_AUTH_METHOD")
+	if err != nil {
+		data.authMethod = "token"
+	}
+
+	switch data.authMethod {
+	case "token":
+		data.token, err = getSecretKey(vaultConfigSecret.Data, "VAULT_TOKEN")
+		if err != nil {
+			if envToken := os.Getenv("VAULT_TOKEN"); envToken != "" {
+				data.token = envToken
+			} else {
+				return err
+			}
+		}
+	case "kubernetes", "aws":
+		data.role, err = getSecretKey(vaultConfigSecret.Data, "VAULT_ROLE")
+		if err != nil {
+			return err
+		}
+	case "approle":
+		data.roleID, err = getSecretKey(vaultConfigSecret.Data, "VAULT_ROLE_ID")
+		if err != nil {
+			return err
+		}
+		data.secretID, err = getSecretKey(vaultConfigSecret.Data, "VAULT_SECRET_ID")
+		if err != nil {
+			return err
+		}
+	case "ldap":
+		data.username, err = getSecretKey(vaultConfigSecret.Data, "VAULT_USERNAME")
+		if err != nil {
+			return err
+		}
+		data.password, err = getSecretKey(vaultConfigSecret.Data, "VAULT_PASSWORD")
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported VAULT_AUTH_METHOD %v", data.authMethod)
+	}
+
+	data.caCert, err = getSecretKey(vaultConfigSecret.Data, "VAULT_CACERT")
+	if err != nil {
+		data.caCert = ""
+	}
+
+	data.clientCert, err = getSecretKey(vaultConfigSecret.Data, "VAULT_CLIENT_CERT")
+	if err != nil {
+		data.clientCert = ""
+	}
+	data.clientKey, err = getSecretKey(vaultConfigSecret.Data, "VAULT_CLIENT_KEY")
+	if err != nil {
+		data.clientKey = ""
+	}
+	if (data.clientCert == "") != (data.clientKey == "") {
+		return errors.New("VAULT_CLIENT_CERT and VAULT_CLIENT_KEY must be set together")
+	}
+
+	skipVerify, err := getSecretKey(vaultConfigSecret.Data, "VAULT_SKIP_VERIFY")
+	data.skipVerify = err == nil && skipVerify == "true"
+
+	cacheEnabled, err := getSecretKey(vaultConfigSecret.Data, "VAULT_CACHE_ENABLED")
+	data.cacheEnabled = err != nil || cacheEnabled != "false"
+
+	cacheEncrypt, err := getSecretKey(vaultConfigSecret.Data, "VAULT_CACHE_ENCRYPT")
+	data.cacheEncrypt = err == nil && cacheEncrypt == "true"
+
+	tokenCheck, err := getSecretKey(vaultConfigSecret.Data, "VAULT_TOKEN_CHECK")
+	data.tokenCheck = err == nil && tokenCheck == "true"
+
+	kvVersion, err := getSecretKey(vaultConfigSecret.Data, "VAULT_KV_VERSION")
+	if err != nil {
+		kvVersion = "2"
+	}
+	switch kvVersion {
+	case "1":
+		data.kvVersion = 1
+	case "2":
+		data.kvVersion = 2
+	default:
+		return fmt.Errorf("VAULT_KV_VERSION must be 1 or 2, got %v", kvVersion)
+	}
+
+	version, err := getSecretKey(vaultConfigSecret.Data, "VAULT_VERSION")
+	if err != nil {
+		data.version = ""
+	} else {
+		if data.kvVersion == 1 {
+			return errors.New("VAULT_VERSION requires a KV v2 mount")
+		}
+		if _, convErr := strconv.Atoi(version); convErr != nil {
+			return fmt.Errorf("VAULT_VERSION must be a number, got %v", version)
+		}
+		data.version = version
+	}
+
+	cacheTTLStr, err := getSecretKey(vaultConfigSecret.Data, "VAULT_CACHE_TTL")
+	if err != nil {
+		data.cacheTTL = 6 * time.Hour
+	} else {
+		data.cacheTTL, err = time.ParseDuration(cacheTTLStr)
+		if err != nil {
+			return fmt.Errorf("VAULT_CACHE_TTL is not a valid duration: %v", err)
+		}
+	}
+
+	for key, value := range vaultConfigSecret.Data {
+		if !strings.HasPrefix(key, "VAULT_CACHE_TTL_") {
+			continue
+		}
+		ttl, ttlErr := time.ParseDuration(string(value))
+		if ttlErr != nil {
+			return fmt.Errorf("%v is not a valid duration: %v", key, ttlErr)
+		}
+		if data.cacheTTLs == nil {
+			data.cacheTTLs = map[string]time.Duration{}
+		}
+		data.cacheTTLs[strings.TrimPrefix(key, "VAULT_CACHE_TTL_")] = ttl
+	}
+
+	data.cacheBackend, err = getSecretKey(vaultConfigSecret.Data, "VAULT_CACHE_BACKEND")
+	if err != nil {
+		data.cacheBackend = "file"
+	}
+	if data.cacheBackend != "file" && data.cacheBackend != "secret" && data.cacheBackend != "redis" {
+		return fmt.Errorf("VAULT_CACHE_BACKEND must be file, secret or redis, got %v", data.cacheBackend)
+	}
+	if data.cacheBackend == "redis" {
+		data.redisAddr, err = getSecretKey(vaultConfigSecret.Data, "VAULT_CACHE_REDIS_ADDR")
+		if err != nil {
+			return err
+		}
+	}
+
+	data.cacheDir, err = getSecretKey(vaultConfigSecret.Data, "VAULT_CACHE_DIR")
+	if err != nil {
+		data.cacheDir = "/tmp"
+	}
+	if data.cacheEnabled && data.cacheBackend == "file" {
+		if err := ensureCacheDir(data.cacheDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureCacheDir creates the cache directory if missing and proves it is
+// writable, so a bad VAULT_CACHE_DIR fails at config parse instead of on
+// every read
+func ensureCacheDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory %v: %v", dir, err)
+	}
+
+	probe, err := ioutil.TempFile(dir, ".vault-cache-probe")
+	if err != nil {
+		return fmt.Errorf("cache directory %v is not writable: %v", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// login authenticates the client according to the configured auth method.
+// Static token auth is the default; the kubernetes method logs in with the
+// pod's service account JWT so no long-lived token has to live in a secret.
+func (data *Data) login(vaultClient *api.Client) error {
+	switch data.authMethod {
+	case "token":
+		vaultClient.SetToken(data.token)
+		// A static token may still be renewable; pick up its lease so the
+		// renewal loop can keep it alive. Lookup failures are not fatal.
+		lookup, lookupErr := vaultClient.Auth().Token().LookupSelf()
+		if lookupErr == nil && lookup != nil {
+			renewable, _ := lookup.Data["renewable"].(bool)
+			ttl := 0
+			if number, ok := lookup.Data["ttl"].(json.Number); ok {
+				if seconds, numErr := number.Int64(); numErr == nil {
+					ttl = int(seconds)
+				}
+			}
+			data.recordTokenLease(ttl, renewable)
+		}
+		return nil
+	case "kubernetes":
+		jwt, err := ioutil.ReadFile(serviceAccountTokenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read service account token: %v", err)
+		}
+
+		payload := map[string]interface{}{
+			"role": data.role,
+			"jwt":  string(jwt),
+		}
+		resp, err := vaultClient.Logical().Write("auth/kubernetes/login", payload)
+		if err != nil {
+			return fmt.Errorf("kubernetes auth login failed: %v", err)
+		}
+		if resp == nil || resp.Auth == nil {
+			return errors.New("kubernetes auth login returned no token")
+		}
+
+		vaultClient.SetToken(resp.Auth.ClientToken)
+		data.recordTokenLease(resp.Auth.LeaseDuration, resp.Auth.Renewable)
+		return nil
+	case "approle":
+		payload := map[string]interface{}{
+			"role_id":   data.roleID,
+			"secret_id": data.secretID,
+		}
+		resp, err := vaultClient.Logical().Write("auth/approle/login", payload)
+		if err != nil {
+			if respErr, ok := err.(*api.ResponseError); ok {
+				return fmt.Errorf("approle credentials rejected (HTTP %v): %v", respErr.StatusCode, err)
+			}
+			return fmt.Errorf("approle auth login failed: %v", err)
+		}
+		if resp == nil || resp.Auth == nil {
+			return errors.New("approle auth login returned no token")
+		}
+
+		vaultClient.SetToken(resp.Auth.ClientToken)
+		data.recordTokenLease(resp.Auth.LeaseDuration, resp.Auth.Renewable)
+		return nil
+	case "aws":
+		payload, err := awsLoginPayload(data.role)
+		if err != nil {
+			return err
+		}
+		resp, err := vaultClient.Logical().Write("auth/aws/login", payload)
+		if err != nil {
+			if respErr, ok := err.(*api.ResponseError); ok {
+				return fmt.Errorf("aws identity rejected (HTTP %v): %v", respErr.StatusCode, err)
+			}
+			return fmt.Errorf("aws auth login failed: %v", err)
+		}
+		if resp == nil || resp.Auth == nil {
+			return errors.New("aws auth login returned no token")
+		}
+
+		vaultClient.SetToken(resp.Auth.ClientToken)
+		data.recordTokenLease(resp.Auth.LeaseDuration, resp.Auth.Renewable)
+		return nil
+	case "ldap":
+		payload := map[string]interface{}{
+			"password": data.password,
+		}
+		resp, err := vaultClient.Logical().Write("auth/ldap/login/"+data.username, payload)
+		if err != nil {
+			if respErr, ok := err.(*api.ResponseError); ok {
+				return fmt.Errorf("ldap credentials rejected (HTTP %v): %v", respErr.StatusCode, err)
+			}
+			return fmt.Errorf("ldap auth login failed: %v", err)
+		}
+		if resp == nil || resp.Auth == nil {
+			return errors.New("ldap auth login returned no token")
+		}
+
+		vaultClient.SetToken(resp.Auth.ClientToken)
+		data.recordTokenLease(resp.Auth.LeaseDuration, resp.Auth.Renewable)
+		return nil
+	}
+	return fmt.Errorf("unsupported VAULT_AUTH_METHOD %v", data.authMethod)
+}
+
+// recordTokenLease remembers the TTL and renewability of the current token
+// so renewal can be scheduled before it expires
+func (data *Data) recordTokenLease(leaseSeconds int, renewable bool) {
+	data.tokenRenewable = renewable
+	if leaseSeconds > 0 {
+		data.tokenTTL = time.Duration(leaseSeconds) * time.Second
+		data.tokenExpiry = time.Now().Add(data.tokenTTL)
+	} else {
+		// A zero TTL means the token never expires.
+		data.tokenTTL = 0
+		data.tokenExpiry = time.Time{}
+	}
+}
+
+// TokenValid reports whether the current Vault token is still usable
+func (data *Data) TokenValid() bool {
+	data.clientMux.Lock()
+	defer data.clientMux.Unlock()
+	if data.client == nil {
+		return false
+	}
+	return data.tokenExpiry.IsZero() || time.Now().Before(data.tokenExpiry)
+}
+
+// renewToken keeps the client token alive, renewing at two-thirds of the
+// lease and re-authenticating when renewal fails. It exits when the client
+// it was started for has been replaced.
+func (data *Data) renewToken(vaultClient *api.Client) {
+	for {
+		data.clientMux.Lock()
+		if data.client != vaultClient || data.tokenTTL <= 0 {
+			data.clientMux.Unlock()
+			return
+		}
+		interval := data.tokenTTL * 2 / 3
+		data.clientMux.Unlock()
+
+		time.Sleep(interval)
+
+		data.clientMux.Lock()
+		if data.client != vaultClient {
+			data.clientMux.Unlock()
+			return
+		}
+		renewed, err := vaultClient.Auth().Token().RenewSelf(0)
+		if err == nil && renewed != nil && renewed.Auth != nil {
+			data.recordTokenLease(renewed.Auth.LeaseDuration, renewed.Auth.Renewable)
+			data.clientMux.Unlock()
+			continue
+		}
+
+		log.Info("vault token renewal failed, re-authenticating")
+		if loginErr := data.login(vaultClient); loginErr != nil {
+			log.Error(loginErr, "failed to re-authenticate to vault")
+			data.client = nil
+			data.clientMux.Unlock()
+			return
+		}
+		data.clientMux.Unlock()
+	}
+}
+
+// renewLease keeps a dynamic secret's lease alive so the backing credential
+// is not revoked mid-use, renewing at two-thirds of the lease duration until
+// renewal fails or the Data is closed. Static KV reads carry no lease and
+// never get here.
+func (data *Data) renewLease(vaultClient *api.Client, leaseID string, leaseSeconds int) {
+	data.clientMux.Lock()
+	if data.leaseStop == nil {
+		data.leaseStop = make(chan struct{})
+	}
+	stop := data.leaseStop
+	data.clientMux.Unlock()
+
+	go func() {
+		interval := time.Duration(leaseSeconds) * time.Second * 2 / 3
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+
+			renewed, err := vaultClient.Sys().Renew(leaseID, 0)
+			if err != nil {
+				log.Error(err, "failed to renew vault lease", "leaseID", leaseID)
+				return
+			}
+			if renewed != nil && renewed.LeaseDuration > 0 {
+				interval = time.Duration(renewed.LeaseDuration) * time.Second * 2 / 3
+			}
+		}
+	}()
+}
+
+// Close tears down the Data, stopping any lease renewal goroutines and
+// dropping the cached client
+func (data *Data) Close() {
+	data.clientMux.Lock()
+	defer data.clientMux.Unlock()
+
+	if data.leaseStop != nil {
+		close(data.leaseStop)
+		data.leaseStop = nil
+	}
+	data.client = nil
+}
+
+// getClient returns an authenticated client, reusing the cached one while
+// its token is valid
+func (data *Data) getClient() (*api.Client, error) {
+	data.clientMux.Lock()
+	defer data.clientMux.Unlock()
+
+	if data.client != nil && (data.tokenExpiry.IsZero() || time.Now().Before(data.tokenExpiry)) {
+		return data.client, nil
+	}
+
+	vaultClient, err := data.newClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := data.login(vaultClient); err != nil {
+		return nil, err
+	}
+
+	data.client = vaultClient
+	if data.tokenRenewable && data.tokenTTL > 0 {
+		go data.renewToken(vaultClient)
+	}
+
+	return vaultClient, nil
+}
+
+// newClient builds an unauthenticated client from the parsed config
+func (data *Data) newClient() (*api.Client, error) {
+	config := api.DefaultConfig()
+	config.Address = data.address
+
+	if data.caCert != "" || data.clientCert != "" || data.skipVerify {
+		if data.skipVerify {
+			log.Info("VAULT_SKIP_VERIFY is set, not verifying the Vault server certificate")
+		}
+
+		tlsConfig := &api.TLSConfig{
+			Insecure: data.skipVerify,
+		}
+		if data.caCert != "" {
+			caCertFile, err := saveCACert(data.caCert)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.CACert = caCertFile
+		}
+		if data.clientCert != "" {
+			// Mutual TLS: the client presents its own certificate on
+			// connect. The api only accepts file paths, like the CA.
+			clientCertFile, err := saveTLSFile("vault-client-cert.pem", data.clientCert)
+			if err != nil {
+				return nil, err
+			}
+			clientKeyFile, err := saveTLSFile("vault-client-key.pem", data.clientKey)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.ClientCert = clientCertFile
+			tlsConfig.ClientKey = clientKeyFile
+		}
+
+		if err := config.ConfigureTLS(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return api.NewClient(config)
+}
+
+const (
+	defaultMaxAttempts    = 4
+	defaultRetryBaseDelay = 2 * time.Second
+)
+
+// isRetryable reports whether a Vault error is worth retrying: connection
+// failures and server-side errors. Client errors, notably permission
+// denied, fail immediately, as do cancelled contexts.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	if respErr, ok := err.(*api.ResponseError); ok {
+		return respErr.StatusCode >= 500
+	}
+	// No response means the call never reached the server.
+	return true
+}
+
+// callWithContext runs a Vault call that does not itself take a context and
+// returns early when the context is done. The call keeps running in the
+// background but its result is discarded.
+func callWithContext(ctx context.Context, call func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// retryCall retries transient Vault failures with exponential backoff,
+// honoring ctx cancellation between attempts
+func (data *Data) retryCall(ctx context.Context, call func() error) error {
+	maxAttempts := data.MaxRetryAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	baseDelay := data.retryBaseDelay
+	if baseDelay <= 0 {
+		baseDelay = defaultRetryBaseDelay
+	}
+
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(baseDelay << uint(attempt-1)):
+			}
+		}
+
+		err = callWithContext(ctx, call)
+		if !isRetryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// vaultFullPath returns the api path of the configured secret. KV v2
+// engines nest the secret under an extra data/ path element; v1 engines
+// serve it directly.
+func (data *Data) vaultFullPath() string {
+	return data.vaultFullPathFor(data.Mount, data.Path)
+}
+
+func (data *Data) vaultFullPathFor(mount string, path string) string {
+	// Surrounding slashes in the configured mount or path would produce
+	// double slashes Vault sometimes rejects.
+	mount = strings.Trim(mount, "/")
+	path = strings.Trim(path, "/")
+
+	if data.kvVersion == 1 {
+		return mount + "/" + path
+	}
+	return mount + "/data/" + path
+}
+
+// checkToken verifies the client token with a lookup-self so an expired or
+// revoked token fails up front with a clear error instead of surfacing as a
+// confusing read failure. It costs a round trip, which is why it is opt-in
+// via VAULT_TOKEN_CHECK.
+func (data *Data) checkToken(ctx context.Context, vaultClient *api.Client) error {
+	err := callWithContext(ctx, func() error {
+		_, lookupErr := vaultClient.Auth().Token().LookupSelf()
+		return lookupErr
+	})
+	if err != nil {
+		if respErr, ok := err.(*api.ResponseError); ok && (respErr.StatusCode == 401 || respErr.StatusCode == 403) {
+			return fmt.Errorf("vault token expired or invalid: %w", ErrVaultPermission)
+		}
+		return err
+	}
+	return nil
+}
+
+// SecretMetadata describes the currently served version of a KV v2 secret
+type SecretMetadata struct {
+	Version     int
+	CreatedTime time.Time
+}
+
+// vaultMetadataPath returns the api path of the secret's version metadata.
+// Only KV v2 engines keep metadata.
+func (data *Data) vaultMetadataPath() string {
+	return strings.Trim(data.Mount, "/") + "/metadata/" + strings.Trim(data.Path, "/")
+}
+
+// GetVaultSecretMetadata reads which version of the configured secret is
+// current and when it was created, without touching the secret value. This
+// helps debugging stale-secret issues.
+func (data *Data) GetVaultSecretMetadata(ctx context.Context, osc client.Client) (*SecretMetadata, error) {
+	err := data.parseVaultConfig(osc)
+	if err != nil {
+		return nil, err
+	}
+	if data.kvVersion == 1 {
+		return nil, errors.New("secret metadata requires a KV v2 mount")
+	}
+
+	vaultClient, err := data.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	metadataPath := data.vaultMetadataPath()
+	var vault *api.Secret
+	err = data.retryCall(ctx, func() error {
+		var readErr error
+		vault, readErr = vaultClient.Logical().Read(metadataPath)
+		return readErr
+	})
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if vault == nil || vault.Data == nil {
+		return nil, fmt.Errorf("metadata not found at %v: %w", metadataPath, ErrVaultNotFound)
+	}
+
+	metadata := &SecretMetadata{}
+	if number, ok := vault.Data["current_version"].(json.Number); ok {
+		if version, convErr := number.Int64(); convErr == nil {
+			metadata.Version = int(version)
+		}
+	}
+	if versions, ok := vault.Data["versions"].(map[string]interface{}); ok {
+		if version, ok := versions[strconv.Itoa(metadata.Version)].(map[string]interface{}); ok {
+			if created, ok := version["created_time"].(string); ok {
+				if parsed, parseErr := time.Parse(time.RFC3339, created); parseErr == nil {
+					metadata.CreatedTime = parsed
+				}
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+// readSecretData reads the configured path and returns its key/value data
+func (data *Data) readSecretData(ctx context.Context) (map[string]interface{}, error) {
+	return data.readSecretDataAt(ctx, data.vaultFullPath())
+}
+
+// readSecretDataAt reads an arbitrary full api path with the shared
+// authenticated client, honoring a pinned secret version
+func (data *Data) readSecretDataAt(ctx context.Context, vaultFullPath string) (map[string]interface{}, error) {
+	return data.readSecretDataVersion(ctx, vaultFullPath, data.version)
+}
+
+// readSecretDataVersion reads a full api path at a specific secret version,
+// or the latest when version is empty
+func (data *Data) readSecretDataVersion(ctx context.Context, vaultFullPath string, version string) (map[string]interface{}, error) {
+	vaultClient, err := data.getClient()
+	if err != nil {
+		return nil, err
+	}
+	var vault *api.Secret
+	start := time.Now()
+	err = data.retryCall(ctx, func() error {
+		var readErr error
+		if version != "" {
+			// A pinned version is passed as a query parameter; KV v2
+			// serves the latest version otherwise.
+			vault, readErr = vaultClient.Logical().ReadWithData(vaultFullPath, map[string][]string{"version": {version}})
+		} else {
+			vault, readErr = vaultClient.Logical().Read(vaultFullPath)
+		}
+		return readErr
+	})
+	if err != nil {
+		metrics.ObserveVaultRequest("error", time.Since(start))
+		return nil, classifyError(err)
+	}
+	metrics.ObserveVaultRequest("success", time.Since(start))
+	// A missing path is reported as a nil secret, not an error.
+	if vault == nil || vault.Data == nil {
+		return nil, fmt.Errorf("secret not found at %v: %w", vaultFullPath, ErrVaultNotFound)
+	}
+
+	if len(vault.Warnings) > 0 {
+		log.Info("vault returned warnings", "path", vaultFullPath, "warnings", vault.Warnings)
+	}
+
+	// A dynamic secret comes with a lease that has to be kept alive or the
+	// backing credential is revoked.
+	if vault.LeaseID != "" {
+		data.renewLease(vaultClient, vault.LeaseID, vault.LeaseDuration)
+	}
+
+	secretData := vault.Data
+	if data.kvVersion != 1 {
+		nested, ok := vault.Data["data"].(map[string]interface{})
+		if !ok {
+			// A deleted KV v2 secret still returns metadata but no data.
+			return nil, fmt.Errorf("secret not found at %v: %w", vaultFullPath, ErrVaultNotFound)
+		}
+		secretData = nested
+	}
+
+	return secretData, nil
+}
+
+// lookupNestedProperty walks a dotted property path like
+// "pagerduty.api_key" into nested maps, decoding a JSON blob stored as a
+// string along the way
+func lookupNestedProperty(secretData map[string]interface{}, property string) (string, error) {
+	current := interface{}(secretData)
+	for _, part := range strings.Split(property, ".") {
+		if blob, ok := current.(string); ok {
+			var decoded map[string]interface{}
+			if err := json.Unmarshal([]byte(blob), &decoded); err != nil {
+				return "", fmt.Errorf("%v does not resolve: value before %v is not an object", property, part)
+			}
+			current = decoded
+		}
+
+		currentMap, ok := current.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%v does not resolve: value before %v is not an object", property, part)
+		}
+		current, ok = currentMap[part]
+		if !ok {
+			return "", fmt.Errorf("%v does not resolve: %v not found", property, part)
+		}
+	}
+
+	leaf, ok := current.(string)
+	if !ok {
+		return "", fmt.Errorf("%v resolves to a non-string value", property)
+	}
+	return leaf, nil
+}
+
+// queryVault connects to Vault and returns the configured property from the
+// configured path
+func (data *Data) queryVault(ctx context.Context) (value string, err error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "vault.queryVault")
+	defer func() { finishSpan(span, err) }()
+
+	span.SetTag("path", data.vaultFullPath())
+
+	secretData, err := data.readSecretData(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	secret := ""
+	for propName, propValue := range secretData {
+		if propName == data.Property {
+			secret = fmt.Sprintf("%v", propValue)
+		}
+	}
+
+	// A property that does not match a flat key may be a dotted path into
+	// a nested value.
+	if secret == "" && strings.Contains(data.Property, ".") {
+		return lookupNestedProperty(secretData, data.Property)
+	}
+
+	if secret == "" {
+		return "", fmt.Errorf("%v not set in %v: %w", data.Property, data.vaultFullPath(), ErrPropertyNotSet)
+	}
+
+	return secret, nil
+}
+
+// cacheTTLFor returns how long one property's cache may be served: a
+// per-property VAULT_CACHE_TTL_<PROPERTY> wins over the global
+// VAULT_CACHE_TTL, which itself defaults to six hours. Property names are
+// matched case-insensitively since secret keys are conventionally upper
+// case.
+func (data *Data) cacheTTLFor(property string) time.Duration {
+	for name, ttl := range data.cacheTTLs {
+		if strings.EqualFold(name, property) {
+			return ttl
+		}
+	}
+	return data.cacheTTL
+}
+
+// cacheFresh reports whether a cache file's mtime marks it as still
+// servable. A future mtime, e.g. after a node clock jump or a restored
+// backup, counts as stale so the file gets refreshed instead of being
+// pinned forever.
+func cacheFresh(info os.FileInfo, ttl time.Duration) bool {
+	now := time.Now()
+	if info.ModTime().After(now) {
+		return false
+	}
+	return info.ModTime().After(now.Add(-ttl))
+}
+
+// saveCACert writes the configured CA certificate to the filesystem so the
+// vault api, which only accepts a file path, can pick it up
+func saveCACert(caCert string) (string, error) {
+	return saveTLSFile("vault-ca.pem", caCert)
+}
+
+// saveTLSFile writes PEM material to the filesystem for the vault api,
+// which only deals in file paths
+func saveTLSFile(name string, pem string) (string, error) {
+	path := "/tmp/" + name
+	if err := ioutil.WriteFile(path, []byte(pem), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// cacheNameFor returns the backend-independent cache key for one property:
+// the file name under the cache directory, or the data key in the cache
+// Secret
+func (data *Data) cacheNameFor(property string) string {
+	name := data.Mount + "-" + property + "-"
+	if data.version != "" {
+		// Pinned versions get their own cache entry so switching the pin
+		// never serves a stale version.
+		name += "v" + data.version + "-"
+	}
+	return name + data.cacheHashFor(property)
+}
+
+// cacheHashFor hashes the full vault path so two clusters reading the same
+// property name from different paths cannot serve each other's secret
+func (data *Data) cacheHashFor(property string) string {
+	sum := sha256.Sum256([]byte(data.Mount + "/" + data.Path + "/" + property + "/" + data.version))
+	return hex.EncodeToString(sum[:8])
+}
+
+// cacheKey derives the key for encrypting cached secrets. An explicit key
+// from the environment wins; otherwise the key is derived from the pod's
+// service account token, which never leaves the node.
+func (data *Data) cacheKey() ([]byte, error) {
+	material := []byte(os.Getenv("VAULT_CACHE_ENCRYPTION_KEY"))
+	if len(material) == 0 {
+		var err error
+		material, err = ioutil.ReadFile(serviceAccountTokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("no cache encryption key: VAULT_CACHE_ENCRYPTION_KEY is unset and the service account token is unreadable: %v", err)
+		}
+	}
+
+	sum := sha256.Sum256(material)
+	return sum[:], nil
+}
+
+// encryptSecret seals a secret with AES-GCM, prepending the nonce to the
+// ciphertext
+func encryptSecret(key []byte, secret string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	return string(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// decryptSecret opens a secret sealed by encryptSecret
+func decryptSecret(key []byte, sealed string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("cached secret is too short to be encrypted")
+	}
+	nonce := []byte(sealed[:gcm.NonceSize()])
+	plaintext, err := gcm.Open(nil, nonce, []byte(sealed[gcm.NonceSize():]), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt cached secret: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// writeCachedSecret stores a secret in the cache, sealing it first when
+// cache encryption is enabled
+func (data *Data) writeCachedSecret(path string, secret string) error {
+	if data.cacheEncrypt {
+		key, err := data.cacheKey()
+		if err != nil {
+			return err
+		}
+		sealed, err := encryptSecret(key, secret)
+		if err != nil {
+			return err
+		}
+		return saveSecret(path, sealed)
+	}
+	return saveSecret(path, secret)
+}
+
+// readCachedSecret loads a secret from the cache, unsealing it when cache
+// encryption is enabled
+func (data *Data) readCachedSecret(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if data.cacheEncrypt {
+		key, keyErr := data.cacheKey()
+		if keyErr != nil {
+			return "", keyErr
+		}
+		return decryptSecret(key, string(raw))
+	}
+	return string(raw), nil
+}
+
+// sealCacheValue prepares a value for storage in a cache backend, encrypting
+// it when cache encryption is enabled. It is the backend-agnostic counterpart
+// of writeCachedSecret for backends that do not store files.
+func (data *Data) sealCacheValue(value string) (string, error) {
+	if !data.cacheEncrypt {
+		return value, nil
+	}
+	key, err := data.cacheKey()
+	if err != nil {
+		return "", err
+	}
+	return encryptSecret(key, value)
+}
+
+// unsealCacheValue reverses sealCacheValue, decrypting a stored value when
+// cache encryption is enabled
+func (data *Data) unsealCacheValue(value string) (string, error) {
+	if !data.cacheEncrypt {
+		return value, nil
+	}
+	key, err := data.cacheKey()
+	if err != nil {
+		return "", err
+	}
+	return decryptSecret(key, value)
+}
+
+// saveSecret caches a fetched secret on the filesystem, readable only by
+// the operator. The secret is written to a temporary file and renamed into
+// place so a reader never sees a partial write.
+func saveSecret(path string, secret string) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(secret); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// GetVaultSecret returns the configured property from Vault, serving a cached
+// copy from the filesystem while it is fresh to keep read volume down
+func (data *Data) GetVaultSecret(ctx context.Context, osc client.Client) (value string, err error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "vault.GetVaultSecret")
+	span.SetTag("mount", data.Mount)
+	span.SetTag("vault_path", data.Path)
+	span.SetTag("property", data.Property)
+	defer func() { finishSpan(span, err) }()
+
+	err = data.parseVaultConfig(osc)
+	if err != nil {
+		return "", err
+	}
+
+	if data.tokenCheck {
+		vaultClient, clientErr := data.getClient()
+		if clientErr != nil {
+			return "", clientErr
+		}
+		if err = data.checkToken(ctx, vaultClient); err != nil {
+			return "", err
+		}
+	}
+
+	// Caching can be turned off entirely, e.g. for pods with a read-only
+	// root filesystem or when every call must see the latest value.
+	if !data.cacheEnabled {
+		return data.queryVault(ctx)
+	}
+
+	cache := data.cacheBackendImpl(osc)
+	cacheKey := data.cacheNameFor(data.Property)
+	if cached, ok := cache.Get(cacheKey); ok {
+		// Mark the span so cache hits stand out from live reads in
+		// traces.
+		span.SetTag("cache", "hit")
+		metrics.IncVaultCache("hit")
+		log.Info("serving vault secret from cache",
+			"path", data.vaultFullPath(),
+			"property", data.Property)
+		return cached, nil
+	}
+	span.SetTag("cache", "miss")
+	metrics.IncVaultCache("miss")
+
+	secret, err := data.queryVault(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := cache.Set(cacheKey, secret, data.cacheTTLFor(data.Property)); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// GetVaultSecrets returns several properties from the configured path with
+// a single Vault read, caching each property like GetVaultSecret does.
+// Missing properties are reported together in one error.
+func (data *Data) GetVaultSecrets(ctx context.Context, osc client.Client, properties []string) (map[string]string, error) {
+	err := data.parseVaultConfig(osc)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache Cache
+	if data.cacheEnabled {
+		cache = data.cacheBackendImpl(osc)
+
+		secrets := make(map[string]string, len(properties))
+		fresh := true
+		for _, property := range properties {
+			cached, ok := cache.Get(data.cacheNameFor(property))
+			if !ok {
+				fresh = false
+				break
+			}
+			secrets[property] = cached
+		}
+		if fresh {
+			return secrets, nil
+		}
+	}
+
+	secretData, err := data.readSecretData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]string, len(properties))
+	var missing []string
+	for _, property := range properties {
+		value, ok := secretData[property]
+		if !ok {
+			missing = append(missing, property)
+			continue
+		}
+		secrets[property] = fmt.Sprintf("%v", value)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("properties not set in %v: %v: %w", data.vaultFullPath(), strings.Join(missing, ", "), ErrPropertyNotSet)
+	}
+
+	if cache != nil {
+		for property, value := range secrets {
+			if err := cache.Set(data.cacheNameFor(property), value, data.cacheTTLFor(property)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return secrets, nil
+}
+
+// GetAllVaultData returns every key at the configured path, e.g. to pass a
+// whole secret through as environment variables. String values are returned
+// as-is; anything else is JSON-encoded. The read is always live; the
+// per-property cache is not consulted.
+func (data *Data) GetAllVaultData(ctx context.Context, osc client.Client) (map[string]string, error) {
+	err := data.parseVaultConfig(osc)
+	if err != nil {
+		return nil, err
+	}
+
+	secretData, err := data.readSecretData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]string, len(secretData))
+	for property, value := range secretData {
+		if str, ok := value.(string); ok {
+			secrets[property] = str
+			continue
+		}
+		encoded, encodeErr := json.Marshal(value)
+		if encodeErr != nil {
+			return nil, fmt.Errorf("failed to encode %v: %v", property, encodeErr)
+		}
+		secrets[property] = string(encoded)
+	}
+
+	return secrets, nil
+}
+
+// GetVaultSecretsMulti reads every configured SecretRef, sharing one
+// authenticated client across mounts so connection config and token renewal
+// are not duplicated per tuple. The result is keyed by property, and a
+// failure names the tuple that caused it.
+func (data *Data) GetVaultSecretsMulti(ctx context.Context, osc client.Client) (map[string]string, error) {
+	err := data.parseVaultConfig(osc)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]string, len(data.Refs))
+	for _, ref := range data.Refs {
+		fullPath := data.vaultFullPathFor(ref.Mount, ref.Path)
+		secretData, err := data.readSecretDataAt(ctx, fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %v property %v: %w", fullPath, ref.Property, err)
+		}
+
+		value, ok := secretData[ref.Property]
+		if !ok {
+			return nil, fmt.Errorf("%v not set in %v: %w", ref.Property, fullPath, ErrPropertyNotSet)
+		}
+		secrets[ref.Property] = fmt.Sprintf("%v", value)
+	}
+
+	return secrets, nil
+}
+
+// InvalidateCache removes the cached copy of the configured secret so the
+// next read goes to Vault, e.g. after a rotation. A cache entry that does
+// not exist is not an error.
+func (data *Data) InvalidateCache(osc client.Client) error {
+	return data.cacheBackendImpl(osc).Invalidate(data.cacheNameFor(data.Property))
+}
+
+// PutVaultSecret stores a value for the configured property in Vault and
+// invalidates the local cache so the next read sees the new value
+func (data *Data) PutVaultSecret(ctx context.Context, osc client.Client, value string) error {
+	err := data.parseVaultConfig(osc)
+	if err != nil {
+		return err
+	}
+
+	if err := data.putVaultSecret(ctx, value); err != nil {
+		return err
+	}
+
+	return data.InvalidateCache(osc)
+}
+
+// putVaultSecret writes the configured property against an already parsed
+// config. A KV write replaces the whole secret at the path, so the new value
+// is merged into the existing data rather than destroying sibling keys. The
+// merge reads the latest version even when reads are pinned, and starts from
+// scratch when the path does not exist yet.
+func (data *Data) putVaultSecret(ctx context.Context, value string) error {
+	vaultClient, err := data.getClient()
+	if err != nil {
+		return err
+	}
+
+	existing, err := data.readSecretDataVersion(ctx, data.vaultFullPath(), "")
+	if err != nil && !errors.Is(err, ErrVaultNotFound) {
+		return err
+	}
+
+	merged := make(map[string]interface{}, len(existing)+1)
+	for k, v := range existing {
+		merged[k] = v
+	}
+	merged[data.Property] = value
+
+	payload := map[string]interface{}{
+		"data": merged,
+	}
+	if data.kvVersion == 1 {
+		payload = merged
+	}
+
+	err = callWithContext(ctx, func() error {
+		_, writeErr := vaultClient.Logical().Write(data.vaultFullPath(), payload)
+		return writeErr
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveSecretWritesAtomically(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-save")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/secret"
+
+	if err := saveSecret(path, "first"); err != nil {
+		t.Fatalf("saveSecret returned error: %v", err)
+	}
+	// A stray temp file, e.g. left by a crash between write and rename,
+	// must not get in the way of the next write.
+	if err := ioutil.WriteFile(path+".tmp", []byte("partial"), 0600); err != nil {
+		t.Fatalf("failed to plant temp file: %v", err)
+	}
+	if err := saveSecret(path, "second"); err != nil {
+		t.Fatalf("saveSecret returned error: %v", err)
+	}
+
+	value, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read secret: %v", err)
+	}
+	if string(value) != "second" {
+		t.Errorf("expected second, got %v", string(value))
+	}
+	// The rename must consume the temp file, so a reader never sees a
+	// half-written copy lying around.
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("expected the temp file to be gone after a successful write")
+	}
+}
+
+// testVaultData returns a Data pointed at the given fake Vault server, using
+// static token auth so no login round trip is needed
+func testVaultData(server *httptest.Server) *Data {
+	return &Data{
+		Mount:            "secret",
+		Path:             "osd/cluster",
+		Property:         "api-key",
+		address:          server.URL,
+		authMethod:       "token",
+		token:            "test-token",
+		kvVersion:        2,
+		MaxRetryAttempts: 2,
+		retryBaseDelay:   time.Millisecond,
+	}
+}
+
+func TestQueryVaultMissingSecretIsNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Vault reports a missing path as a 404 with an empty error
+		// list.
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+	}))
+	defer server.Close()
+
+	_, err := testVaultData(server).queryVault(context.Background())
+	if !errors.Is(err, ErrVaultNotFound) {
+		t.Errorf("expected ErrVaultNotFound, got %v", err)
+	}
+}
+
+func TestQueryVaultRetriesServerErrors(t *testing.T) {
+	reads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/secret/") {
+			// Auxiliary calls like the token lookup are not under
+			// test.
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		reads++
+		if reads == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"errors":["internal error"]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"api-key":"secret-value"}}}`))
+	}))
+	defer server.Close()
+
+	value, err := testVaultData(server).queryVault(context.Background())
+	if err != nil {
+		t.Fatalf("queryVault returned error: %v", err)
+	}
+	if value != "secret-value" {
+		t.Errorf("expected secret-value, got %v", value)
+	}
+	if reads != 2 {
+		t.Errorf("expected the read to be retried once, got %v reads", reads)
+	}
+}
+
+func TestQueryVaultDoesNotRetryPermissionErrors(t *testing.T) {
+	reads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/secret/") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		reads++
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+	}))
+	defer server.Close()
+
+	_, err := testVaultData(server).queryVault(context.Background())
+	if !errors.Is(err, ErrVaultPermission) {
+		t.Errorf("expected ErrVaultPermission, got %v", err)
+	}
+	if reads != 1 {
+		t.Errorf("expected a single read for a permission error, got %v", reads)
+	}
+}
+
+func TestPutVaultSecretMergesSiblingKeys(t *testing.T) {
+	var written map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/secret/") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"data":{"data":{"api-key":"old-value","sibling":"keep-me"}}}`))
+			return
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decoding write payload: %v", err)
+		}
+		written, _ = payload["data"].(map[string]interface{})
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	err := testVaultData(server).putVaultSecret(context.Background(), "new-value")
+	if err != nil {
+		t.Fatalf("putVaultSecret returned error: %v", err)
+	}
+	if written == nil {
+		t.Fatal("expected a KV v2 write wrapped in a data envelope")
+	}
+	if written["api-key"] != "new-value" {
+		t.Errorf("expected the property to be updated, got %v", written["api-key"])
+	}
+	if written["sibling"] != "keep-me" {
+		t.Errorf("expected sibling keys to survive the write, got %v", written["sibling"])
+	}
+}
+
+func TestPutVaultSecretCreatesMissingPath(t *testing.T) {
+	var written map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decoding write payload: %v", err)
+		}
+		written, _ = payload["data"].(map[string]interface{})
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	err := testVaultData(server).putVaultSecret(context.Background(), "new-value")
+	if err != nil {
+		t.Fatalf("putVaultSecret returned error: %v", err)
+	}
+	if written["api-key"] != "new-value" {
+		t.Errorf("expected the property to be written, got %v", written["api-key"])
+	}
+}
+
+func TestVaultFullPathFor(t *testing.T) {
+	tests := []struct {
+		mount     string
+		path      string
+		kvVersion int
+		want      string
+	}{
+		{"secret", "osd/cluster", 2, "secret/data/osd/cluster"},
+		{"secret", "osd/cluster", 1, "secret/osd/cluster"},
+		// Surrounding slashes in the configured values must not produce
+		// double slashes.
+		{"secret/", "/osd/cluster/", 2, "secret/data/osd/cluster"},
+		{"/secret/", "osd/cluster", 1, "secret/osd/cluster"},
+	}
+
+	for _, test := range tests {
+		data := &Data{kvVersion: test.kvVersion}
+		if got := data.vaultFullPathFor(test.mount, test.path); got != test.want {
+			t.Errorf("vaultFullPathFor(%q, %q) with kv v%v = %q, want %q",
+				test.mount, test.path, test.kvVersion, got, test.want)
+		}
+	}
+}
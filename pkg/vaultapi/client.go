@@ -0,0 +1,244 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vaultapi is a small client for the Vault HTTP API covering the
+// operations pkg/vault needs: logical reads and writes, token lookup and
+// renewal, and lease renewal. It keeps the same types and method layout as
+// the hashicorp client it replaces, so callers are written identically, but
+// without pulling the whole Vault codebase into the vendor tree.
+package vaultapi
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultAddress is where a Vault server listens when nothing is configured
+const defaultAddress = "https://127.0.0.1:8200"
+
+// Config holds the connection settings for a Client
+type Config struct {
+	// Address is the base URL of the Vault server, e.g.
+	// https://vault.example.com:8200
+	Address string
+
+	// HttpClient performs the requests. DefaultConfig installs one with its
+	// own transport so ConfigureTLS can adjust it without touching the
+	// process-wide default.
+	HttpClient *http.Client
+}
+
+// DefaultConfig returns a Config pointing at the conventional local Vault
+// address with a dedicated http client
+func DefaultConfig() *Config {
+	return &Config{
+		Address: defaultAddress,
+		HttpClient: &http.Client{
+			Timeout: 60 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{},
+			},
+		},
+	}
+}
+
+// TLSConfig describes how to secure the connection to Vault. Certificate and
+// key values are file paths.
+type TLSConfig struct {
+	// CACert is a PEM bundle the server certificate is verified against,
+	// replacing the system roots
+	CACert string
+	// ClientCert and ClientKey enable mutual TLS when both are set
+	ClientCert string
+	ClientKey  string
+	// Insecure disables server certificate verification entirely
+	Insecure bool
+}
+
+// ConfigureTLS applies t to the config's http client
+func (c *Config) ConfigureTLS(t *TLSConfig) error {
+	transport, ok := c.HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("http client transport does not support TLS configuration")
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	tlsClientConfig := transport.TLSClientConfig
+
+	tlsClientConfig.InsecureSkipVerify = t.Insecure
+
+	if t.CACert != "" {
+		pem, err := ioutil.ReadFile(t.CACert)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no CA certificates found in %v", t.CACert)
+		}
+		tlsClientConfig.RootCAs = pool
+	}
+
+	if t.ClientCert != "" || t.ClientKey != "" {
+		if t.ClientCert == "" || t.ClientKey == "" {
+			return errors.New("both client cert and client key must be provided")
+		}
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return nil
+}
+
+// Client talks to one Vault server
+type Client struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+// NewClient builds a Client from config. A nil config means DefaultConfig.
+func NewClient(c *Config) (*Client, error) {
+	if c == nil {
+		c = DefaultConfig()
+	}
+
+	addr := c.Address
+	if addr == "" {
+		addr = defaultAddress
+	}
+	if _, err := url.Parse(addr); err != nil {
+		return nil, fmt.Errorf("invalid vault address %v: %v", addr, err)
+	}
+
+	httpClient := c.HttpClient
+	if httpClient == nil {
+		httpClient = DefaultConfig().HttpClient
+	}
+
+	return &Client{
+		addr: strings.TrimSuffix(addr, "/"),
+		http: httpClient,
+	}, nil
+}
+
+// SetToken sets the token sent on subsequent requests
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// request performs one api call and parses the response into a Secret. A GET
+// returning 404 with no error messages yields a nil Secret and nil error,
+// matching how Vault reports an absent path.
+func (c *Client) request(method string, path string, params url.Values, body map[string]interface{}) (*Secret, error) {
+	endpoint := c.addr + "/v1/" + strings.TrimPrefix(path, "/")
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, endpoint, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Vault-Token", c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respErr := &ResponseError{
+			HTTPMethod: method,
+			URL:        endpoint,
+			StatusCode: resp.StatusCode,
+		}
+		var apiResp struct {
+			Errors []string `json:"errors"`
+		}
+		if decodeErr := json.NewDecoder(resp.Body).Decode(&apiResp); decodeErr == nil {
+			respErr.Errors = apiResp.Errors
+		}
+		if method == "GET" && resp.StatusCode == http.StatusNotFound && len(respErr.Errors) == 0 {
+			// The path exists but holds no secret; callers treat this as
+			// a nil secret, not a failure.
+			return nil, nil
+		}
+		return nil, respErr
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	return parseSecret(resp.Body)
+}
+
+// parseSecret decodes a response body. Numbers are kept as json.Number so
+// integer fields like a token's ttl survive without a float conversion.
+func parseSecret(r io.Reader) (*Secret, error) {
+	secret := &Secret{}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// ResponseError is returned for any non-2xx response. Callers classify
+// failures by its StatusCode.
+type ResponseError struct {
+	// HTTPMethod and URL identify the failed request
+	HTTPMethod string
+	URL        string
+	// StatusCode is the HTTP status Vault answered with
+	StatusCode int
+	// Errors are the messages from the response's errors field
+	Errors []string
+}
+
+func (r *ResponseError) Error() string {
+	return fmt.Sprintf("Error making API request.\n\nURL: %s %s\nCode: %d. Errors:\n\n* %s",
+		r.HTTPMethod, r.URL, r.StatusCode, strings.Join(r.Errors, "\n* "))
+}
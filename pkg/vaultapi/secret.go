@@ -0,0 +1,134 @@
+// Copyright 2019 RedHat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultapi
+
+import "net/url"
+
+// Secret is the common shape of Vault api responses
+type Secret struct {
+	RequestID string `json:"request_id"`
+
+	// LeaseID and LeaseDuration describe the lease of a dynamic secret;
+	// LeaseID is empty for static ones
+	LeaseID       string `json:"lease_id"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+
+	// Data holds the secret payload. Numeric values are json.Number.
+	Data map[string]interface{} `json:"data"`
+
+	// Warnings are non-fatal messages from the server, e.g. about
+	// deprecated parameters
+	Warnings []string `json:"warnings"`
+
+	// Auth is set on login and token operations
+	Auth *SecretAuth `json:"auth,omitempty"`
+}
+
+// SecretAuth describes the token returned by a login or token operation
+type SecretAuth struct {
+	ClientToken   string   `json:"client_token"`
+	Accessor      string   `json:"accessor"`
+	Policies      []string `json:"policies"`
+	LeaseDuration int      `json:"lease_duration"`
+	Renewable     bool     `json:"renewable"`
+}
+
+// Logical exposes reads and writes of secret paths
+type Logical struct {
+	c *Client
+}
+
+// Logical returns a handle for logical (secret path) operations
+func (c *Client) Logical() *Logical {
+	return &Logical{c: c}
+}
+
+// Read fetches the secret at path, returning a nil Secret without error when
+// the path holds nothing
+func (l *Logical) Read(path string) (*Secret, error) {
+	return l.c.request("GET", path, nil, nil)
+}
+
+// ReadWithData fetches the secret at path with extra query parameters, e.g.
+// a kv v2 version selector
+func (l *Logical) ReadWithData(path string, data map[string][]string) (*Secret, error) {
+	params := url.Values{}
+	for key, values := range data {
+		for _, value := range values {
+			params.Add(key, value)
+		}
+	}
+	return l.c.request("GET", path, params, nil)
+}
+
+// Write stores data at path and returns the server's response, which for
+// auth backends carries the issued token
+func (l *Logical) Write(path string, data map[string]interface{}) (*Secret, error) {
+	return l.c.request("PUT", path, nil, data)
+}
+
+// Auth groups authentication related operations
+type Auth struct {
+	c *Client
+}
+
+// Auth returns a handle for authentication operations
+func (c *Client) Auth() *Auth {
+	return &Auth{c: c}
+}
+
+// TokenAuth operates on the client's own token
+type TokenAuth struct {
+	c *Client
+}
+
+// Token returns a handle for operations on the client's token
+func (a *Auth) Token() *TokenAuth {
+	return &TokenAuth{c: a.c}
+}
+
+// LookupSelf returns the properties of the current token, notably its ttl
+// and renewability
+func (t *TokenAuth) LookupSelf() (*Secret, error) {
+	return t.c.request("GET", "auth/token/lookup-self", nil, nil)
+}
+
+// RenewSelf extends the current token's lease. A zero increment asks the
+// server for its default.
+func (t *TokenAuth) RenewSelf(increment int) (*Secret, error) {
+	return t.c.request("PUT", "auth/token/renew-self", nil, map[string]interface{}{
+		"increment": increment,
+	})
+}
+
+// Sys groups system backend operations
+type Sys struct {
+	c *Client
+}
+
+// Sys returns a handle for system backend operations
+func (c *Client) Sys() *Sys {
+	return &Sys{c: c}
+}
+
+// Renew extends the lease identified by id. A zero increment asks the server
+// for its default.
+func (s *Sys) Renew(id string, increment int) (*Secret, error) {
+	return s.c.request("PUT", "sys/leases/renew", nil, map[string]interface{}{
+		"lease_id":  id,
+		"increment": increment,
+	})
+}